@@ -0,0 +1,878 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The API reference is generated from the Doxygen XML output of local
+// checkouts of the modules, configured in config.json:
+//
+//	"api": {"mr-math": "../mr-math/build/doxygen/xml"}
+//
+// Every namespace, class, function and enum gets a page under
+// /api/<module>/, e.g. /api/mr-math/mr/Vec3f/length/, and /api/<module>/
+// itself is the symbol index of the module.
+
+// apiTemplate renders all pages of the API reference
+const apiTemplate = "templates/api.html"
+
+// apiCompoundKinds are the Doxygen compounds that become pages; files,
+// directories and Doxygen pages are left out, except for the functions and
+// enums of the global namespace, which Doxygen only lists in their files
+var apiCompoundKinds = map[string]bool{"namespace": true, "class": true, "struct": true, "union": true}
+
+// apiParameterKeys label the parameter lists of descriptions
+var apiParameterKeys = map[string]string{
+	"param":         "api.parameters",
+	"templateparam": "api.template_parameters",
+	"retval":        "api.return_values",
+	"exception":     "api.exceptions",
+}
+
+// apiSectionKeys label the \return, \note, \warning and \see sections of
+// descriptions
+var apiSectionKeys = map[string]string{
+	"return":  "api.returns",
+	"note":    "api.note",
+	"warning": "api.warning",
+	"see":     "api.see_also",
+}
+
+// APIModule is the API reference of one module
+type APIModule struct {
+	Name    string
+	Root    *APISymbol   // Symbol index, its children are the top-level scopes
+	Symbols []*APISymbol // Every symbol of the module
+
+	// Pages and anchors of Doxygen ids, to resolve cross-references
+	refs  map[string]apiRef
+	paths map[string]bool
+}
+
+// apiRef is the target of a Doxygen cross-reference
+type apiRef struct {
+	Symbol *APISymbol
+	Anchor string
+}
+
+// APISymbol is a namespace, class, function or enum with a page of its own
+type APISymbol struct {
+	Kind      string // module, namespace, class, struct, union, function or enum
+	Name      string // e.g. length
+	Qualified string // e.g. mr::Vec3f::length
+	Path      string // Route, e.g. /api/mr-math/mr/Vec3f/length
+	Parent    *APISymbol
+	Children  []*APISymbol
+
+	Compound doxCompound // Namespaces and classes
+	Members  []doxMember // Overloads of a function, or the enum
+
+	module *APIModule
+}
+
+// LoadAPI reads the Doxygen XML output of the modules. Modules whose output
+// has not been generated are skipped, so the site builds without checkouts.
+func LoadAPI(dirs map[string]string) ([]*APIModule, error) {
+	var names []string
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var modules []*APIModule
+	for _, name := range names {
+		index := filepath.Join(dirs[name], "index.xml")
+		if _, err := os.Stat(index); errors.Is(err, os.ErrNotExist) {
+			log.Printf("No API reference for %s: %s not found", name, index)
+			continue
+		}
+		module, err := loadAPIModule(name, dirs[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
+
+// loadAPIModule reads the compounds listed in index.xml and builds the
+// symbol tree from their nesting
+func loadAPIModule(name, dir string) (*APIModule, error) {
+	var index struct {
+		Compounds []struct {
+			RefID string `xml:"refid,attr"`
+			Kind  string `xml:"kind,attr"`
+		} `xml:"compound"`
+	}
+	if err := readXML(filepath.Join(dir, "index.xml"), &index); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	var files []doxCompound
+	compounds := make(map[string]doxCompound)
+	for _, c := range index.Compounds {
+		if !apiCompoundKinds[c.Kind] && c.Kind != "file" {
+			continue
+		}
+		var file struct {
+			Compound doxCompound `xml:"compounddef"`
+		}
+		if err := readXML(filepath.Join(dir, c.RefID+".xml"), &file); err != nil {
+			return nil, err
+		}
+		if c.Kind == "file" {
+			files = append(files, file.Compound)
+			continue
+		}
+		ids = append(ids, c.RefID)
+		compounds[c.RefID] = file.Compound
+	}
+
+	// Compounds nested in no other one are the top-level scopes
+	nested := make(map[string]bool)
+	for _, c := range compounds {
+		for _, inner := range c.inner() {
+			nested[inner.RefID] = true
+		}
+	}
+
+	m := &APIModule{Name: name, refs: make(map[string]apiRef), paths: make(map[string]bool)}
+	m.Root = &APISymbol{Kind: "module", Name: name, Path: "/api/" + name, module: m}
+	for _, id := range ids {
+		if !nested[id] {
+			m.addCompound(compounds[id], compounds, m.Root)
+		}
+	}
+
+	// Files list the members of the namespaces declared in them as well;
+	// those of the global namespace have ids of the file
+	functions := make(map[string]*APISymbol)
+	for _, file := range files {
+		m.addMembers(file.Sections, m.Root, functions, func(member doxMember) bool {
+			return strings.HasPrefix(member.ID, file.ID+"_")
+		})
+	}
+	sort.Slice(m.Symbols, func(i, j int) bool {
+		return m.Symbols[i].Qualified < m.Symbols[j].Qualified
+	})
+	return m, nil
+}
+
+// readXML decodes an XML file
+func readXML(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return nil
+}
+
+// addCompound adds a namespace or class with its public members and nested
+// scopes below parent
+func (m *APIModule) addCompound(c doxCompound, compounds map[string]doxCompound, parent *APISymbol) {
+	// Anonymous namespaces and classes have generated names containing @
+	if strings.Contains(c.Name, "@") || c.Prot == "private" || c.Prot == "protected" {
+		return
+	}
+	name := c.Name
+	if parent.Qualified != "" {
+		name = strings.TrimPrefix(name, parent.Qualified+"::")
+	}
+	symbol := m.add(&APISymbol{Kind: c.Kind, Name: name, Qualified: c.Name, Compound: c}, parent)
+	m.refs[c.ID] = apiRef{Symbol: symbol}
+
+	m.addMembers(c.Sections, symbol, make(map[string]*APISymbol), nil)
+
+	for _, inner := range c.inner() {
+		if child, ok := compounds[inner.RefID]; ok {
+			m.addCompound(child, compounds, symbol)
+		}
+	}
+}
+
+// addMembers adds the public functions and enums of sections to scope.
+// Overloads share the page in functions; members that include rejects are
+// left out.
+func (m *APIModule) addMembers(sections []doxSection, scope *APISymbol, functions map[string]*APISymbol, include func(doxMember) bool) {
+	qualified := func(name string) string {
+		if scope.Qualified == "" {
+			return name
+		}
+		return scope.Qualified + "::" + name
+	}
+	for _, section := range sections {
+		for _, member := range section.Members {
+			if member.Prot != "public" || include != nil && !include(member) {
+				continue
+			}
+			switch member.Kind {
+			case "function":
+				function, ok := functions[member.Name]
+				if !ok {
+					function = m.add(&APISymbol{Kind: "function", Name: member.Name, Qualified: qualified(member.Name)}, scope)
+					functions[member.Name] = function
+				}
+				function.Members = append(function.Members, member)
+				m.refs[member.ID] = apiRef{Symbol: function, Anchor: member.ID}
+			case "enum":
+				enum := m.add(&APISymbol{Kind: "enum", Name: member.Name, Qualified: qualified(member.Name), Members: []doxMember{member}}, scope)
+				m.refs[member.ID] = apiRef{Symbol: enum}
+				for _, value := range member.Values {
+					m.refs[value.ID] = apiRef{Symbol: enum, Anchor: value.ID}
+				}
+			}
+		}
+	}
+}
+
+// add gives a symbol its route below parent and registers it
+func (m *APIModule) add(symbol *APISymbol, parent *APISymbol) *APISymbol {
+	symbol.Parent = parent
+	symbol.Path = parent.Path + "/" + apiSlug(symbol.Name)
+	if m.paths[symbol.Path] {
+		// A function named like a class in the same scope
+		symbol.Path += "-" + symbol.Kind
+	}
+	symbol.module = m
+	m.paths[symbol.Path] = true
+	parent.Children = append(parent.Children, symbol)
+	m.Symbols = append(m.Symbols, symbol)
+	return symbol
+}
+
+// apiOperatorNames spell out the characters of operators and template
+// arguments in routes, e.g. operator+= becomes operator-plus-eq
+var apiOperatorNames = map[rune]string{
+	'+': "plus", '-': "minus", '*': "star", '/': "slash", '%': "mod",
+	'=': "eq", '<': "lt", '>': "gt", '!': "not", '&': "and", '|': "or",
+	'^': "xor", '~': "tilde", '[': "index", '(': "call", ',': "comma",
+}
+
+// apiSlug turns a symbol name into a path segment
+func apiSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range name {
+		if word, ok := apiOperatorNames[r]; ok {
+			if b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteString(word)
+			dash = true
+			continue
+		}
+		if r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash {
+				b.WriteByte('-')
+				dash = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// apiPages returns the pages of the API reference: an overview of the
+// modules, the symbol index of each module and a page per symbol
+func apiPages(modules []*APIModule) []Page {
+	if len(modules) == 0 {
+		return nil
+	}
+	result := []Page{apiPage("/api")}
+	for _, m := range modules {
+		result = append(result, apiPage(m.Root.Path))
+		for _, symbol := range m.Symbols {
+			result = append(result, apiPage(symbol.Path))
+		}
+	}
+	return result
+}
+
+// apiPage returns the page entry of a route of the API reference
+func apiPage(route string) Page {
+	name := strings.TrimPrefix(route, "/")
+	return Page{Name: name, Path: route, Template: apiTemplate, Output: name}
+}
+
+// The Doxygen XML schema, as far as the reference uses it
+
+type doxCompound struct {
+	ID         string       `xml:"id,attr"`
+	Kind       string       `xml:"kind,attr"`
+	Prot       string       `xml:"prot,attr"`
+	Name       string       `xml:"compoundname"`
+	Bases      []doxRef     `xml:"basecompoundref"`
+	Namespaces []doxRef     `xml:"innernamespace"`
+	Classes    []doxRef     `xml:"innerclass"`
+	Templates  []doxParam   `xml:"templateparamlist>param"`
+	Sections   []doxSection `xml:"sectiondef"`
+	Brief      doxMarkup    `xml:"briefdescription"`
+	Detail     doxMarkup    `xml:"detaileddescription"`
+	Location   doxLocation  `xml:"location"`
+}
+
+// inner returns the namespaces and classes nested in the compound
+func (c doxCompound) inner() []doxRef {
+	return append(append([]doxRef{}, c.Namespaces...), c.Classes...)
+}
+
+type doxRef struct {
+	RefID string `xml:"refid,attr"`
+	Prot  string `xml:"prot,attr"`
+	Virt  string `xml:"virt,attr"`
+	Name  string `xml:",chardata"`
+}
+
+type doxSection struct {
+	Kind    string      `xml:"kind,attr"`
+	Members []doxMember `xml:"memberdef"`
+}
+
+type doxMember struct {
+	ID        string         `xml:"id,attr"`
+	Kind      string         `xml:"kind,attr"`
+	Prot      string         `xml:"prot,attr"`
+	Static    string         `xml:"static,attr"`
+	Constexpr string         `xml:"constexpr,attr"`
+	Explicit  string         `xml:"explicit,attr"`
+	Virt      string         `xml:"virt,attr"`
+	Strong    string         `xml:"strong,attr"` // enum class
+	Templates []doxParam     `xml:"templateparamlist>param"`
+	Type      doxMarkup      `xml:"type"`
+	Name      string         `xml:"name"`
+	Args      string         `xml:"argsstring"`
+	Params    []doxParam     `xml:"param"`
+	Values    []doxEnumValue `xml:"enumvalue"`
+	Brief     doxMarkup      `xml:"briefdescription"`
+	Detail    doxMarkup      `xml:"detaileddescription"`
+	Location  doxLocation    `xml:"location"`
+}
+
+type doxParam struct {
+	Type     doxMarkup `xml:"type"`
+	DeclName string    `xml:"declname"`
+	DefVal   doxMarkup `xml:"defval"`
+}
+
+type doxEnumValue struct {
+	ID          string    `xml:"id,attr"`
+	Name        string    `xml:"name"`
+	Initializer string    `xml:"initializer"`
+	Brief       doxMarkup `xml:"briefdescription"`
+}
+
+type doxLocation struct {
+	File string `xml:"file,attr"`
+	Line int    `xml:"line,attr"`
+}
+
+// String returns the location as file:line
+func (l doxLocation) String() string {
+	if l.File == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+// doxMarkup is a description or type as Doxygen markup, converted to HTML
+// when a page is rendered
+type doxMarkup struct {
+	Inner string `xml:",innerxml"`
+}
+
+// APIView is the data of an API reference page
+type APIView struct {
+	Kind   string // "modules" for the overview, "module" for a symbol index, otherwise the symbol kind
+	Title  string
+	Module *DocLink  // Symbol index of the module
+	Scopes []DocLink // Enclosing namespaces and classes
+
+	Brief, Detail template.HTML
+	Declarations  []APIDeclaration
+	Values        []APIValue // Enumerators
+	Groups        []APIGroup // Symbols listed on the page
+	Location      string
+}
+
+// APIDeclaration is a declaration with its documentation, one per overload
+// of a function
+type APIDeclaration struct {
+	ID            string
+	Signature     template.HTML
+	Brief, Detail template.HTML
+	Location      string
+}
+
+// APIValue is an enumerator
+type APIValue struct {
+	ID          string
+	Name        string
+	Initializer string
+	Brief       template.HTML
+}
+
+// APIGroup lists the symbols of one kind: namespace, class, enum or function
+type APIGroup struct {
+	Kind    string
+	Entries []APIEntry
+}
+
+// APIEntry links to a symbol
+type APIEntry struct {
+	Title string
+	URL   string
+	Brief template.HTML
+}
+
+// apiGroupKinds orders the groups of symbols and folds structs and unions
+// into classes
+var apiGroupKinds = map[string]string{"namespace": "namespace", "class": "class", "struct": "class", "union": "class", "enum": "enum", "function": "function"}
+
+// apiView builds the page of a route of the API reference in the given
+// language, or returns nil for other pages
+func (s *Site) apiView(p Page, lang string) *APIView {
+	if p.Name == "api" {
+		view := &APIView{Kind: "modules", Title: string(s.Catalogs.Translate(lang, "api.title"))}
+		group := APIGroup{Kind: "module"}
+		for _, m := range s.api {
+			group.Entries = append(group.Entries, APIEntry{Title: m.Name, URL: s.URL(m.Root.Path, lang)})
+		}
+		view.Groups = []APIGroup{group}
+		return view
+	}
+
+	symbol, ok := s.apiSymbols[p.Name]
+	if !ok {
+		return nil
+	}
+	m := symbol.module
+	link := s.apiLinker(m, lang)
+	linkSymbol := s.symbolResolver(p.Path, lang)
+	view := &APIView{
+		Kind:   symbol.Kind,
+		Title:  symbol.Qualified,
+		Module: &DocLink{Title: m.Name, URL: s.URL(m.Root.Path, lang)},
+	}
+	for scope := symbol.Parent; scope != nil && scope != m.Root; scope = scope.Parent {
+		view.Scopes = append([]DocLink{{Title: scope.Name, URL: s.URL(scope.Path, lang)}}, view.Scopes...)
+	}
+
+	switch symbol.Kind {
+	case "module":
+		view.Title = string(s.Catalogs.Translate(lang, "api.index", "module", m.Name))
+		view.Groups = s.apiGroups(m.Symbols, true, linkSymbol, lang)
+	case "function":
+		for _, member := range symbol.Members {
+			view.Declarations = append(view.Declarations, APIDeclaration{
+				ID:        member.ID,
+				Signature: s.apiFunctionSignature(member, link),
+				Brief:     s.apiHTML(member.Brief, link, linkSymbol, lang),
+				Detail:    s.apiHTML(member.Detail, link, linkSymbol, lang),
+				Location:  member.Location.String(),
+			})
+		}
+	case "enum":
+		member := symbol.Members[0]
+		view.Brief = s.apiHTML(member.Brief, link, linkSymbol, lang)
+		view.Detail = s.apiHTML(member.Detail, link, linkSymbol, lang)
+		view.Location = member.Location.String()
+		view.Declarations = []APIDeclaration{{Signature: s.apiEnumSignature(symbol, link)}}
+		for _, value := range member.Values {
+			view.Values = append(view.Values, APIValue{
+				ID:          value.ID,
+				Name:        value.Name,
+				Initializer: value.Initializer,
+				Brief:       s.apiHTML(value.Brief, link, linkSymbol, lang),
+			})
+		}
+	default:
+		c := symbol.Compound
+		view.Brief = s.apiHTML(c.Brief, link, linkSymbol, lang)
+		view.Detail = s.apiHTML(c.Detail, link, linkSymbol, lang)
+		view.Location = c.Location.String()
+		if c.Kind != "namespace" {
+			view.Declarations = []APIDeclaration{{Signature: s.apiClassSignature(c, link)}}
+		}
+		view.Groups = s.apiGroups(symbol.Children, false, linkSymbol, lang)
+	}
+	return view
+}
+
+// apiGroups sorts symbols into groups by kind, titled by their qualified
+// names in the symbol index and by their own names elsewhere
+func (s *Site) apiGroups(symbols []*APISymbol, qualified bool, linkSymbol func(string) string, lang string) []APIGroup {
+	var groups []APIGroup
+	for _, kind := range []string{"namespace", "class", "enum", "function"} {
+		group := APIGroup{Kind: kind}
+		for _, symbol := range symbols {
+			if apiGroupKinds[symbol.Kind] != kind {
+				continue
+			}
+			entry := APIEntry{Title: symbol.Name, URL: s.URL(symbol.Path, lang), Brief: s.apiHTML(symbol.brief(), s.apiLinker(symbol.module, lang), linkSymbol, lang)}
+			if qualified {
+				entry.Title = symbol.Qualified
+			}
+			group.Entries = append(group.Entries, entry)
+		}
+		if len(group.Entries) > 0 {
+			sort.SliceStable(group.Entries, func(i, j int) bool {
+				return group.Entries[i].Title < group.Entries[j].Title
+			})
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// brief returns the short description of a symbol, that of the first
+// overload for functions
+func (symbol *APISymbol) brief() doxMarkup {
+	if len(symbol.Members) > 0 {
+		return symbol.Members[0].Brief
+	}
+	return symbol.Compound.Brief
+}
+
+// apiLinker returns a function that resolves Doxygen ids of a module to
+// URLs in the given language, or "" for ids without a page
+func (s *Site) apiLinker(m *APIModule, lang string) func(string) string {
+	return func(refid string) string {
+		ref, ok := m.refs[refid]
+		if !ok {
+			return ""
+		}
+		url := s.URL(ref.Symbol.Path, lang)
+		if ref.Anchor != "" {
+			url += "#" + ref.Anchor
+		}
+		return url
+	}
+}
+
+// apiFunctionSignature renders the declaration of a function overload with
+// the types in it linked
+func (s *Site) apiFunctionSignature(member doxMember, link func(string) string) template.HTML {
+	var b strings.Builder
+	b.WriteString(s.apiTemplateParams(member.Templates, link))
+	for _, specifier := range []struct {
+		set  bool
+		word string
+	}{
+		{member.Static == "yes", "static"},
+		{member.Virt == "virtual" || member.Virt == "pure-virtual", "virtual"},
+		{member.Explicit == "yes", "explicit"},
+		{member.Constexpr == "yes", "constexpr"},
+	} {
+		if specifier.set {
+			b.WriteString(specifier.word + " ")
+		}
+	}
+	if result := s.apiHTML(member.Type, link, nil, ""); result != "" {
+		b.WriteString(string(result) + " ")
+	}
+	b.WriteString(template.HTMLEscapeString(member.Name))
+	b.WriteString("(")
+	for i, param := range member.Params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(s.apiParam(param, link))
+	}
+	b.WriteString(")")
+	b.WriteString(template.HTMLEscapeString(argsSuffix(member.Args)))
+	return template.HTML(b.String())
+}
+
+// apiClassSignature renders the declaration of a class with its bases
+func (s *Site) apiClassSignature(c doxCompound, link func(string) string) template.HTML {
+	var b strings.Builder
+	b.WriteString(s.apiTemplateParams(c.Templates, link))
+	b.WriteString(c.Kind + " " + template.HTMLEscapeString(c.Name))
+	for i, base := range c.Bases {
+		if i == 0 {
+			b.WriteString(" : ")
+		} else {
+			b.WriteString(", ")
+		}
+		if base.Prot != "" {
+			b.WriteString(base.Prot + " ")
+		}
+		if base.Virt == "virtual" {
+			b.WriteString("virtual ")
+		}
+		name := template.HTMLEscapeString(base.Name)
+		if url := link(base.RefID); url != "" {
+			name = `<a href="` + template.HTMLEscapeString(url) + `">` + name + `</a>`
+		}
+		b.WriteString(name)
+	}
+	return template.HTML(b.String())
+}
+
+// apiEnumSignature renders the declaration of an enum
+func (s *Site) apiEnumSignature(symbol *APISymbol, link func(string) string) template.HTML {
+	member := symbol.Members[0]
+	declaration := "enum "
+	if member.Strong == "yes" {
+		declaration += "class "
+	}
+	declaration += template.HTMLEscapeString(symbol.Qualified)
+	if underlying := s.apiHTML(member.Type, link, nil, ""); underlying != "" {
+		declaration += " : " + string(underlying)
+	}
+	return template.HTML(declaration)
+}
+
+// apiTemplateParams renders a template parameter list on a line of its own
+func (s *Site) apiTemplateParams(params []doxParam, link func(string) string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	list := make([]string, len(params))
+	for i, param := range params {
+		list[i] = s.apiParam(param, link)
+	}
+	return "template&lt;" + strings.Join(list, ", ") + "&gt;\n"
+}
+
+// apiParam renders a function or template parameter
+func (s *Site) apiParam(param doxParam, link func(string) string) string {
+	result := string(s.apiHTML(param.Type, link, nil, ""))
+	if param.DeclName != "" && !strings.HasSuffix(result, " "+param.DeclName) {
+		result += " " + template.HTMLEscapeString(param.DeclName)
+	}
+	if value := s.apiHTML(param.DefVal, link, nil, ""); value != "" {
+		result += " = " + string(value)
+	}
+	return result
+}
+
+// argsSuffix returns what follows the parameter list in a Doxygen
+// argsstring, such as " const noexcept"
+func argsSuffix(args string) string {
+	depth := 0
+	for i, r := range args {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return args[i+1:]
+			}
+		}
+	}
+	return ""
+}
+
+// apiHTML converts Doxygen markup to HTML, linking cross-references with
+// link, C++ names in code with linkSymbol, and labelling sections with
+// messages in lang. Elements without an HTML counterpart are replaced by
+// their content.
+func (s *Site) apiHTML(markup doxMarkup, link, linkSymbol func(string) string, lang string) template.HTML {
+	var b strings.Builder
+	var closers []string
+	var open []string // Names of the open elements
+	decoder := xml.NewDecoder(strings.NewReader(markup.Inner))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Printf("Error in Doxygen markup: %v", err)
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "indexentry" || t.Name.Local == "anchor" {
+				decoder.Skip()
+				continue
+			}
+			// Doxygen nests lists, code and sections in paragraphs, which
+			// HTML does not allow: the paragraph is closed around them
+			inPara := apiBlockElements[t.Name.Local] && len(open) > 0 && open[len(open)-1] == "para"
+			if t.Name.Local == "programlisting" || t.Name.Local == "computeroutput" {
+				code := s.apiCode(decoder, t, link, linkSymbol)
+				if inPara {
+					code = "</p>" + code + "<p>"
+				}
+				b.WriteString(code)
+				continue
+			}
+			start, end := s.apiElement(t, link, lang)
+			if inPara {
+				start = "</p>" + start
+				end += "<p>"
+			}
+			b.WriteString(start)
+			closers = append(closers, end)
+			open = append(open, t.Name.Local)
+		case xml.EndElement:
+			b.WriteString(closers[len(closers)-1])
+			closers = closers[:len(closers)-1]
+			open = open[:len(open)-1]
+		case xml.CharData:
+			b.WriteString(template.HTMLEscapeString(string(t)))
+		}
+	}
+	html := apiEmptyParagraph.ReplaceAllString(b.String(), "")
+	return template.HTML(strings.TrimSpace(html))
+}
+
+// apiCode renders a code listing or inline code, reading it to its end
+// element. Listings are highlighted and inline code that is a single name
+// is linked; inline code with cross-references keeps those instead.
+func (s *Site) apiCode(decoder *xml.Decoder, start xml.StartElement, link, linkSymbol func(string) string) string {
+	var code doxMarkup
+	if err := decoder.DecodeElement(&code, &start); err != nil {
+		log.Printf("Error in Doxygen markup: %v", err)
+		return ""
+	}
+	if start.Name.Local == "computeroutput" {
+		if strings.Contains(code.Inner, "<") {
+			return "<code>" + string(s.apiHTML(code, link, linkSymbol, "")) + "</code>"
+		}
+		return inlineCode(html.UnescapeString(code.Inner), linkSymbol)
+	}
+
+	// Listings are lines of text, spaces and references to symbols
+	var b strings.Builder
+	listing := xml.NewDecoder(strings.NewReader(code.Inner))
+	for {
+		token, err := listing.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "sp" {
+				b.WriteString(" ")
+			}
+		case xml.EndElement:
+			if t.Name.Local == "codeline" {
+				b.WriteString("\n")
+			}
+		case xml.CharData:
+			b.WriteString(string(t))
+		}
+	}
+	return codeBlock(strings.TrimSuffix(b.String(), "\n"), "cpp", "", linkSymbol)
+}
+
+// apiBlockElements are the Doxygen elements rendered as HTML block
+// elements, which cannot be part of a paragraph
+var apiBlockElements = map[string]bool{
+	"programlisting": true, "verbatim": true, "itemizedlist": true, "orderedlist": true,
+	"table": true, "heading": true, "parameterlist": true, "simplesect": true,
+}
+
+// apiEmptyParagraph matches the paragraphs left empty by closing them
+// around block elements
+var apiEmptyParagraph = regexp.MustCompile(`<p>\s*</p>`)
+
+// apiElement returns the HTML that opens and closes a Doxygen element
+func (s *Site) apiElement(e xml.StartElement, link func(string) string, lang string) (string, string) {
+	attr := func(name string) string {
+		for _, a := range e.Attr {
+			if a.Name.Local == name {
+				return a.Value
+			}
+		}
+		return ""
+	}
+	label := func(key string) string {
+		return `<div class="api-section"><h4>` + string(s.Catalogs.Translate(lang, key)) + `</h4>`
+	}
+
+	switch e.Name.Local {
+	case "para":
+		return "<p>", "</p>"
+	case "bold":
+		return "<strong>", "</strong>"
+	case "emphasis":
+		return "<em>", "</em>"
+	case "superscript":
+		return "<sup>", "</sup>"
+	case "subscript":
+		return "<sub>", "</sub>"
+	case "ref":
+		if url := link(attr("refid")); url != "" {
+			return `<a href="` + template.HTMLEscapeString(url) + `">`, "</a>"
+		}
+	case "ulink":
+		return `<a href="` + template.HTMLEscapeString(attr("url")) + `">`, "</a>"
+	case "itemizedlist":
+		return "<ul>", "</ul>"
+	case "orderedlist":
+		return "<ol>", "</ol>"
+	case "listitem":
+		return "<li>", "</li>"
+	case "linebreak":
+		return "<br>", ""
+	case "ndash":
+		return "–", ""
+	case "mdash":
+		return "—", ""
+	case "nonbreakablespace":
+		return "&nbsp;", ""
+	case "verbatim":
+		return "<pre>", "</pre>"
+	case "heading":
+		return "<h4>", "</h4>"
+	case "table":
+		return "<table>", "</table>"
+	case "row":
+		return "<tr>", "</tr>"
+	case "entry":
+		if attr("thead") == "yes" {
+			return "<th>", "</th>"
+		}
+		return "<td>", "</td>"
+	case "parameterlist":
+		if key, ok := apiParameterKeys[attr("kind")]; ok {
+			return label(key) + "<dl>", "</dl></div>"
+		}
+		return "<dl>", "</dl>"
+	case "parametername":
+		return "<dt><code>", "</code></dt>"
+	case "parameterdescription":
+		return "<dd>", "</dd>"
+	case "simplesect":
+		if key, ok := apiSectionKeys[attr("kind")]; ok {
+			return label(key), "</div>"
+		}
+		return `<div class="api-section">`, "</div>"
+	}
+	return "", ""
+}
+
+// apiMessageKeys returns the messages the API reference uses from Go code,
+// for the translation check
+func apiMessageKeys() []string {
+	keys := []string{"api.title", "api.index"}
+	for _, key := range apiParameterKeys {
+		keys = append(keys, key)
+	}
+	for _, key := range apiSectionKeys {
+		keys = append(keys, key)
+	}
+	return keys
+}
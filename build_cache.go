@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// The static site generator records the inputs each page was rendered from
+// in a build cache: the files it read, such as templates, Markdown pages,
+// snippet sources and releases.json, and the message keys it looked up.
+// A rebuild only renders the pages whose inputs changed and copies the rest
+// from the previous output. Inputs every page depends on, such as the
+// program itself, the configuration and the API reference, are hashed
+// together; when they change every page is rendered again.
+
+// buildCacheDir holds the build cache of each output directory
+const buildCacheDir = ".build-cache"
+
+// Dependencies records the inputs a response was rendered from. The
+// generator records one per request; its methods do nothing on nil, so the
+// live server records nothing.
+type Dependencies struct {
+	Files    map[string]bool // Files and directories read
+	Messages map[string]bool // Message keys looked up in the page's language
+}
+
+// newDependencies creates an empty record
+func newDependencies() *Dependencies {
+	return &Dependencies{Files: make(map[string]bool), Messages: make(map[string]bool)}
+}
+
+// file records files or directories a response was rendered from
+func (d *Dependencies) file(paths ...string) {
+	if d == nil {
+		return
+	}
+	for _, path := range paths {
+		if path != "" {
+			d.Files[path] = true
+		}
+	}
+}
+
+// message records message keys a response looked up
+func (d *Dependencies) message(keys ...string) {
+	if d == nil {
+		return
+	}
+	for _, key := range keys {
+		d.Messages[key] = true
+	}
+}
+
+// Recorder records the inputs of the pages one worker of the generator
+// renders, one page at a time. It keeps its own copies of the templates,
+// made once per file and language, whose helpers record into the
+// dependencies of the current page, so templates are not copied per page.
+type Recorder struct {
+	deps      *Dependencies
+	templates map[string]map[string]*template.Template
+}
+
+// newRecorder creates a recorder
+func newRecorder() *Recorder {
+	return &Recorder{templates: make(map[string]map[string]*template.Template)}
+}
+
+// start begins recording the inputs of another page
+func (r *Recorder) start() *Dependencies {
+	r.deps = newDependencies()
+	return r.deps
+}
+
+// current returns the record of the page being rendered, nil on a nil
+// recorder
+func (r *Recorder) current() *Dependencies {
+	if r == nil {
+		return nil
+	}
+	return r.deps
+}
+
+// template returns the recorder's copy of a parsed template file in lang,
+// or nil if the file did not parse
+func (r *Recorder) template(s *Site, file, lang string) *template.Template {
+	if t, ok := r.templates[file][lang]; ok {
+		return t
+	}
+	base, ok := s.bases[file]
+	if !ok {
+		return nil
+	}
+	if r.templates[file] == nil {
+		r.templates[file] = make(map[string]*template.Template)
+	}
+	t := template.Must(base.Clone()).Funcs(s.funcs(lang, r))
+	r.templates[file][lang] = t
+	return t
+}
+
+type recorderKey struct{}
+
+// withRecorder returns the request recording its inputs with rec
+func withRecorder(r *http.Request, rec *Recorder) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), recorderKey{}, rec))
+}
+
+// requestRecorder returns the recorder of a request, or nil
+func requestRecorder(r *http.Request) *Recorder {
+	rec, _ := r.Context().Value(recorderKey{}).(*Recorder)
+	return rec
+}
+
+// BuildCache is what the last build of an output directory was made from
+type BuildCache struct {
+	Inputs string                `json:"inputs"` // Hash of the inputs of every page
+	Pages  map[string]CachedPage `json:"pages"`  // Per URL
+}
+
+// CachedPage is a generated file with the inputs it was rendered from
+type CachedPage struct {
+	File     string            `json:"file"` // Relative to the output directory
+	Hash     string            `json:"hash"` // Of the file
+	Lang     string            `json:"lang,omitempty"`
+	Files    map[string]string `json:"files"`    // Hash per input file or directory
+	Messages map[string]string `json:"messages"` // Hash per message key, in Lang
+	Links    []string          `json:"links"`    // Links in the file, to crawl on
+	Symbols  SymbolIssues      `json:"symbols"`  // Identifiers that could not be linked
+}
+
+// newBuildCache creates an empty cache
+func newBuildCache(inputs string) *BuildCache {
+	return &BuildCache{Inputs: inputs, Pages: make(map[string]CachedPage)}
+}
+
+// buildCachePath returns the cache file of an output directory
+func buildCachePath(outputDir string) string {
+	abs, err := filepath.Abs(outputDir)
+	if err != nil {
+		abs = outputDir
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(buildCacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadBuildCache reads a build cache. A cache that is missing, unreadable or
+// made from other inputs of every page is empty.
+func loadBuildCache(path, inputs string) *BuildCache {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return newBuildCache(inputs)
+	}
+	var cache BuildCache
+	if err := json.Unmarshal(data, &cache); err != nil || cache.Inputs != inputs || cache.Pages == nil {
+		return newBuildCache(inputs)
+	}
+	return &cache
+}
+
+// save writes the cache
+func (c *BuildCache) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// inputHashes hashes input files and directories, each once per build
+type inputHashes map[string]string
+
+// file returns the hash of a file, or of the names and contents of the
+// files below a directory. Missing files hash to "".
+func (h inputHashes) file(path string) string {
+	if hash, ok := h[path]; ok {
+		return hash
+	}
+	hash, err := hashTree(path, true)
+	if err != nil {
+		hash = ""
+	}
+	h[path] = hash
+	return hash
+}
+
+// hashTree hashes a file or the files below a directory, with their
+// contents or only their names
+func hashTree(root string, contents bool) (string, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if !info.IsDir() {
+		data, err := os.ReadFile(root)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	err = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\n", filepath.ToSlash(rel))
+		if contents {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			fmt.Fprintf(h, "%x\n", sum)
+		}
+		return nil
+	})
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+// hashMessage hashes the text of a message key in a language, including the
+// fallback to the source language
+func hashMessage(catalogs Catalogs, lang, key string) string {
+	message, ok := catalogs.Message(lang, key)
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(message))
+	return hex.EncodeToString(sum[:])
+}
+
+// globalInputs hashes what every page depends on: the program, the
+// configuration, the API reference and manual symbols that code is linked
+// with, the commits snippets are taken from, which content pages exist,
+// since any page may link to them, and the year of the build clock
+func globalInputs(config Config, site *Site) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "year %d\n", site.clock.Year())
+
+	program, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(program)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+
+	data, err = json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+
+	files := []string{symbolsFile}
+	for _, module := range sortedKeys(config.API) {
+		files = append(files, config.API[module])
+	}
+	for _, file := range files {
+		hash, err := hashTree(file, true)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", file, hash)
+	}
+	for _, module := range sortedKeys(config.Sources) {
+		fmt.Fprintf(h, "%s %s\n", module, site.sources.commit(module))
+	}
+
+	names, err := hashTree("content", false)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	fmt.Fprintf(h, "content %s\n", names)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
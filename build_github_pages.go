@@ -1,158 +1,452 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"html/template"
-	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
-// GitHubPagesGenerator handles building static files for GitHub Pages
+// GitHubPagesGenerator handles building static files for GitHub Pages.
+// Instead of rendering templates on its own it crawls the same router the
+// live server uses, so the static site matches what `go run .` serves.
+// Pages that fail are collected in the report and the build goes on, so one
+// run lists every broken page, but the output is only replaced by a build
+// without failures.
 type GitHubPagesGenerator struct {
-	OutputDir string
+	OutputDir  string
+	ReportPath string // Where to write the JSON build report, if anywhere
+	Jobs       int    // Pages rendered at the same time
+	Force      bool   // Render every page instead of reusing unchanged ones
+	NoCache    bool   // Neither read nor write the build cache
+	buildDir   string // Temporary directory the site is built in
+	config     Config
+	site       *Site
+	router     chi.Router
+	visited    map[string]bool
+	linkedFrom map[string]string // First page linking to each URL
+	queue      []string
+	report     BuildReport
+
+	// Inputs of the pages of the previous build and of this one, and the
+	// hashes of the input files
+	cache  *BuildCache
+	next   *BuildCache
+	hashes inputHashes
+
+	// Page and language served at each URL, to tell which page failed
+	pages map[string]pageURL
+}
+
+// pageURL is a page in one language
+type pageURL struct {
+	page Page
+	lang string
 }
 
 // NewGitHubPagesGenerator creates a new generator instance
-func NewGitHubPagesGenerator() *GitHubPagesGenerator {
-	return &GitHubPagesGenerator{
-		OutputDir: "docs",
+func NewGitHubPagesGenerator(config Config, outputDir string) (*GitHubPagesGenerator, error) {
+	site, err := NewSite(config, true)
+	if err != nil {
+		return nil, err
+	}
+	// The download page and /download/releases.json would be published
+	// without any builds to download
+	if len(site.Releases.Releases) == 0 {
+		return nil, fmt.Errorf("%s lists no releases, add the published builds before generating the site", releasesFile)
+	}
+	g := &GitHubPagesGenerator{
+		OutputDir:  outputDir,
+		Jobs:       runtime.NumCPU(),
+		config:     config,
+		site:       site,
+		router:     newRouter(site),
+		visited:    make(map[string]bool),
+		linkedFrom: make(map[string]string),
+		pages:      make(map[string]pageURL),
 	}
+	for _, p := range site.Pages {
+		for _, locale := range site.Locales {
+			g.pages[site.URL(p.Path, locale.Code)] = pageURL{p, locale.Code}
+		}
+	}
+	return g, nil
 }
 
-// Run executes the static site generation process
-func (g *GitHubPagesGenerator) Run() {
+// Run executes the static site generation process. It fails if the output
+// cannot be set up or any page failed, leaving the previous output alone.
+func (g *GitHubPagesGenerator) Run() error {
 	fmt.Println("Building static site for GitHub Pages...")
+	fmt.Printf("Build time %s (%s)\n", g.site.clock.Format(time.RFC3339), g.site.clockSource)
 
-	g.setupDirectories()
-	g.generateAllPages()
+	restored, err := recoverOutput(g.OutputDir)
+	if err != nil {
+		return fmt.Errorf("failed to recover %s from an interrupted build: %v", g.OutputDir, err)
+	}
+	if restored {
+		fmt.Printf("Restored %s, which an interrupted build had moved aside\n", g.OutputDir)
+	}
 
-	fmt.Println("\nStatic site generation complete!")
-	fmt.Println("\nTo deploy to GitHub Pages:")
-	fmt.Println("1. Create a GitHub repository")
-	fmt.Println("2. Commit and push your code including the 'docs' directory")
-	fmt.Println("3. Go to repository Settings -> Pages")
-	fmt.Println("4. Under 'Source', select 'Deploy from a branch'")
-	fmt.Println("5. Select 'main' branch and '/docs' folder, then click 'Save'")
-	fmt.Println("\nYour site will be available at https://yourusername.github.io/repository-name/")
-}
+	g.buildDir, err = newBuildDir(g.OutputDir)
+	if err != nil {
+		return fmt.Errorf("failed to create build directory: %v", err)
+	}
+	// Gone after a successful build, which moves it into place
+	defer os.RemoveAll(g.buildDir)
 
-// setupDirectories creates the necessary directory structure
-func (g *GitHubPagesGenerator) setupDirectories() {
-	dirs := []string{
-		g.OutputDir,
-		filepath.Join(g.OutputDir, "features"),
-		filepath.Join(g.OutputDir, "examples"),
-		filepath.Join(g.OutputDir, "docs"),
-		filepath.Join(g.OutputDir, "download"),
-		filepath.Join(g.OutputDir, "subprojects/mr-graphics"),
-		filepath.Join(g.OutputDir, "subprojects/mr-importer"),
-		filepath.Join(g.OutputDir, "subprojects/mr-contractor"),
-		filepath.Join(g.OutputDir, "subprojects/mr-math"),
-	}
-
-	for _, dir := range dirs {
-		err := os.MkdirAll(dir, 0755)
-		if err != nil {
-			log.Fatalf("Failed to create directory %s: %v", dir, err)
+	inputs, err := globalInputs(g.config, g.site)
+	if err != nil {
+		return fmt.Errorf("failed to hash the inputs of the site: %v", err)
+	}
+	cachePath := buildCachePath(g.OutputDir)
+	g.cache = newBuildCache(inputs)
+	if !g.Force && !g.NoCache {
+		g.cache = loadBuildCache(cachePath, inputs)
+	}
+	g.next = newBuildCache(inputs)
+	g.hashes = make(inputHashes)
+
+	if err := g.setupDirectories(); err != nil {
+		return err
+	}
+	if err := g.crawl(); err != nil {
+		return err
+	}
+
+	// Links to symbols are a convenience, so problems are only reported
+	if !g.site.SymbolReport.OK() {
+		fmt.Println()
+		g.site.SymbolReport.Print()
+	}
+
+	if err := g.verify(); err != nil {
+		g.writeReport()
+		fmt.Println()
+		g.report.Print()
+		fmt.Printf("\n%s was left unchanged\n", g.OutputDir)
+		return err
+	}
+	if err := copyPreserved(g.OutputDir, g.buildDir); err != nil {
+		return fmt.Errorf("failed to keep files of %s: %v", g.OutputDir, err)
+	}
+	g.report.Changes, err = diffOutputs(g.OutputDir, g.buildDir)
+	if err != nil {
+		return fmt.Errorf("failed to compare with %s: %v", g.OutputDir, err)
+	}
+	if err := replaceOutput(g.buildDir, g.OutputDir); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", g.OutputDir, err)
+	}
+	if !g.NoCache {
+		if err := g.next.save(cachePath); err != nil {
+			return fmt.Errorf("failed to write build cache: %v", err)
 		}
 	}
+	if err := g.writeReport(); err != nil {
+		return err
+	}
+	return nil
+}
 
+// verify checks that the build is complete enough to be published
+func (g *GitHubPagesGenerator) verify() error {
+	if !g.report.OK() {
+		return fmt.Errorf("%d of %d pages failed", len(g.report.Failures), len(g.report.Failures)+g.report.Pages+g.report.Redirects)
+	}
+	if _, err := os.Stat(filepath.Join(g.buildDir, "index.html")); err != nil {
+		return fmt.Errorf("the build has no home page: %v", err)
+	}
+	return nil
+}
+
+// writeReport writes the JSON build report if one was asked for
+func (g *GitHubPagesGenerator) writeReport() error {
+	if g.ReportPath == "" {
+		return nil
+	}
+	if err := g.report.Write(g.ReportPath); err != nil {
+		return fmt.Errorf("failed to write build report: %v", err)
+	}
+	return nil
+}
+
+// setupDirectories fills the build directory with the files that are not
+// produced by the router
+func (g *GitHubPagesGenerator) setupDirectories() error {
 	// Create empty .nojekyll file to disable Jekyll processing
-	noJekyllPath := filepath.Join(g.OutputDir, ".nojekyll")
+	noJekyllPath := filepath.Join(g.buildDir, ".nojekyll")
 	if err := os.WriteFile(noJekyllPath, []byte{}, 0644); err != nil {
-		log.Fatalf("Failed to create .nojekyll file: %v", err)
+		return fmt.Errorf("failed to create .nojekyll file: %v", err)
 	}
 
 	// Copy assets directory
-	if err := g.copyDirectory("assets", filepath.Join(g.OutputDir, "assets")); err != nil {
-		log.Fatalf("Failed to copy assets: %v", err)
+	if err := g.copyDirectory("assets", filepath.Join(g.buildDir, "assets")); err != nil {
+		return fmt.Errorf("failed to copy assets: %v", err)
 	}
+	return nil
 }
 
-// generateAllPages generates all static HTML pages
-func (g *GitHubPagesGenerator) generateAllPages() {
-	// Generate home page
-	g.generatePage("index.html", "templates/layout.html", "templates/home.html", PageData{Title: "model-renderer"})
-
-	// Generate features page
-	g.generatePage("features/index.html", "templates/layout.html", "templates/features.html", PageData{Title: "Features - model-renderer"})
-
-	// Generate examples page
-	g.generatePage("examples/index.html", "templates/layout.html", "templates/examples.html", PageData{Title: "Examples - model-renderer"})
+// linkPattern matches the targets of href and src attributes
+var linkPattern = regexp.MustCompile(`(?:href|src)="([^"]*)"`)
+
+// crawl requests every registered route and follows the internal links
+// found in the responses until no new pages are discovered. The URLs queued
+// so far are rendered concurrently, then saved and logged in queue order,
+// and the links they contain make up the next round. That keeps the output
+// and the log the same whatever the number of jobs. Pages whose inputs did
+// not change since the last build are copied from the output instead.
+func (g *GitHubPagesGenerator) crawl() error {
+	err := chi.Walk(g.router, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// Wildcard routes such as /assets/* are not pages
+		if method == http.MethodGet && !strings.ContainsAny(route, "*{") {
+			g.enqueue(route, "")
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list routes: %v", err)
+	}
 
-	// Generate subproject pages
-	g.generatePage("subprojects/mr-graphics/index.html", "templates/layout.html", "templates/subprojects/mr-graphics.html", PageData{Title: "mr-graphics - model-renderer"})
-	g.generatePage("subprojects/mr-importer/index.html", "templates/layout.html", "templates/subprojects/mr-importer.html", PageData{Title: "mr-importer - model-renderer"})
-	g.generatePage("subprojects/mr-contractor/index.html", "templates/layout.html", "templates/subprojects/mr-contractor.html", PageData{Title: "mr-contractor - model-renderer"})
-	g.generatePage("subprojects/mr-math/index.html", "templates/layout.html", "templates/subprojects/mr-math.html", PageData{Title: "mr-math - model-renderer"})
+	for len(g.queue) > 0 {
+		round := g.queue
+		g.queue = nil
 
-	// Create simple redirects for docs and download
-	g.generateRedirect("docs/index.html", "/")
-	g.generateRedirect("docs/index_ru.html", "/index_ru.html")
-	g.generateRedirect("download/index.html", "/")
-	g.generateRedirect("download/index_ru.html", "/index_ru.html")
+		reused := make(map[string]CachedPage)
+		var targets []string
+		for _, target := range round {
+			if page, ok := g.unchanged(target); ok {
+				reused[target] = page
+			} else {
+				targets = append(targets, target)
+			}
+		}
+		responses := g.render(targets)
+		for _, target := range round {
+			if page, ok := reused[target]; ok {
+				g.reuse(target, page)
+				continue
+			}
+			g.save(target, responses[0])
+			responses = responses[1:]
+		}
+	}
+	return nil
+}
 
-	// Fix all the HTML files to work with GitHub Pages static structure
-	g.fixLanguageLinks()
+// response is a rendered URL with the inputs it was rendered from
+type response struct {
+	*httptest.ResponseRecorder
+	deps *Dependencies
 }
 
-// generatePage renders a template to a static HTML file
-func (g *GitHubPagesGenerator) generatePage(outputPath, layoutPath, contentPath string, data PageData) {
-	// Parse templates
-	tmpl, err := template.ParseFiles(layoutPath, "templates/translations.html", contentPath)
-	if err != nil {
-		log.Fatalf("Failed to parse templates %s and %s: %v", layoutPath, contentPath, err)
+// render requests URLs from the router with up to Jobs workers and returns
+// the responses in the same order
+func (g *GitHubPagesGenerator) render(targets []string) []response {
+	responses := make([]response, len(targets))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < max(1, min(g.Jobs, len(targets))); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			recorder := newRecorder()
+			for i := range next {
+				rec := httptest.NewRecorder()
+				deps := recorder.start()
+				g.router.ServeHTTP(rec, withRecorder(httptest.NewRequest(http.MethodGet, targets[i], nil), recorder))
+				responses[i] = response{rec, deps}
+			}
+		}()
+	}
+	for i := range targets {
+		next <- i
 	}
+	close(next)
+	wg.Wait()
+	return responses
+}
 
-	// Create output file
-	outputFile := filepath.Join(g.OutputDir, outputPath)
-	file, err := os.Create(outputFile)
-	if err != nil {
-		log.Fatalf("Failed to create file %s: %v", outputFile, err)
+// enqueue schedules an internal URL for crawling unless it was already seen.
+// from is the page linking to it, empty for registered routes.
+func (g *GitHubPagesGenerator) enqueue(target, from string) {
+	u, err := url.Parse(target)
+	if err != nil || u.IsAbs() || u.Host != "" || !strings.HasPrefix(u.Path, g.site.BasePath) {
+		return
+	}
+	// Assets are copied as a whole by setupDirectories
+	if strings.HasPrefix(u.Path, g.site.URL("/assets/", "")) {
+		return
 	}
-	defer file.Close()
 
-	// Add Lang field and Year to data
-	data.Lang = "en"
-	data.Year = time.Now().Year()
-	data.BaseURL = "/" // Base URL for GitHub Pages
+	u.Fragment = ""
+	key := u.String()
+	if g.visited[key] {
+		return
+	}
+	g.visited[key] = true
+	g.linkedFrom[key] = from
+	g.queue = append(g.queue, key)
+}
 
-	// Execute template and write to file
-	if err := tmpl.ExecuteTemplate(file, "layout", data); err != nil {
-		log.Fatalf("Failed to execute template for %s: %v", outputPath, err)
+// outputPath returns the file a URL is written to, relative to the output
+func (g *GitHubPagesGenerator) outputPath(req *http.Request) string {
+	// GitHub Pages serves directories from their index file
+	outputPath := strings.TrimPrefix(req.URL.Path, g.site.BasePath)
+	if outputPath == "" || strings.HasSuffix(outputPath, "/") {
+		outputPath += "index.html"
 	}
+	return outputPath
+}
 
-	fmt.Printf("Generated %s\n", outputFile)
+// save writes the response to a URL, queues the links in it and remembers
+// what it was rendered from
+func (g *GitHubPagesGenerator) save(target string, rec response) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	outputPath := g.outputPath(req)
 
-	// If we're generating the main English version, also generate Russian version
-	if !strings.Contains(outputPath, "_ru") {
-		// Create output file for Russian version
-		ruOutputPath := strings.Replace(outputPath, "index.html", "index_ru.html", 1)
-		ruOutputFile := filepath.Join(g.OutputDir, ruOutputPath)
-		ruFile, err := os.Create(ruOutputFile)
+	switch {
+	case rec.Code >= 300 && rec.Code < 400:
+		location, err := req.URL.Parse(rec.Header().Get("Location"))
 		if err != nil {
-			log.Fatalf("Failed to create file %s: %v", ruOutputFile, err)
+			g.fail(req, fmt.Errorf("invalid redirect: %v", err))
+			return
+		}
+		g.enqueue(location.String(), req.URL.Path)
+		if err := g.generateRedirect(outputPath, location.Path); err != nil {
+			g.fail(req, err)
+			return
 		}
-		defer ruFile.Close()
+		g.report.Redirects++
+	case rec.Code == http.StatusOK:
+		body := rec.Body.Bytes()
+		outputFile := filepath.Join(g.buildDir, outputPath)
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			g.fail(req, fmt.Errorf("failed to create directory for %s: %v", outputPath, err))
+			return
+		}
+		if err := os.WriteFile(outputFile, body, 0644); err != nil {
+			g.fail(req, fmt.Errorf("failed to create file %s: %v", outputPath, err))
+			return
+		}
+		fmt.Printf("Generated %s\n", filepath.Join(g.OutputDir, outputPath))
+		g.report.Pages++
+
+		var links []string
+		for _, match := range linkPattern.FindAllSubmatch(body, -1) {
+			links = append(links, string(match[1]))
+			g.enqueue(string(match[1]), req.URL.Path)
+		}
+		g.remember(req, outputPath, body, links, rec.deps)
+	case rec.Code == http.StatusInternalServerError:
+		// The body is the error of the page
+		g.fail(req, errors.New(strings.TrimSpace(rec.Body.String())))
+	default:
+		g.fail(req, fmt.Errorf("%d %s", rec.Code, strings.TrimSpace(rec.Body.String())))
+	}
+}
 
-		// Set language to Russian for this version
-		data.Lang = "ru"
+// remember adds a generated page to the build cache with the hashes of the
+// inputs it was rendered from
+func (g *GitHubPagesGenerator) remember(req *http.Request, outputPath string, body []byte, links []string, deps *Dependencies) {
+	sum := sha256.Sum256(body)
+	page := CachedPage{
+		File:     outputPath,
+		Hash:     hex.EncodeToString(sum[:]),
+		Files:    make(map[string]string),
+		Messages: make(map[string]string),
+		Links:    links,
+	}
+	for file := range deps.Files {
+		page.Files[file] = g.hashes.file(file)
+	}
+	if p, ok := g.pages[req.URL.Path]; ok {
+		page.Lang = p.lang
+		page.Symbols = g.site.SymbolReport.route(p.page.Path)
+	}
+	for key := range deps.Messages {
+		page.Messages[key] = hashMessage(g.site.Catalogs, page.Lang, key)
+	}
+	g.next.Pages[req.URL.String()] = page
+}
 
-		// Execute template and write to file
-		if err := tmpl.ExecuteTemplate(ruFile, "layout", data); err != nil {
-			log.Fatalf("Failed to execute template for %s: %v", ruOutputPath, err)
+// unchanged returns the cached page of a URL if neither its inputs nor the
+// file in the output changed since it was generated
+func (g *GitHubPagesGenerator) unchanged(target string) (CachedPage, bool) {
+	page, ok := g.cache.Pages[target]
+	if !ok {
+		return page, false
+	}
+	for file, hash := range page.Files {
+		if g.hashes.file(file) != hash {
+			return page, false
+		}
+	}
+	for key, hash := range page.Messages {
+		if hashMessage(g.site.Catalogs, page.Lang, key) != hash {
+			return page, false
+		}
+	}
+	return page, g.hashes.file(filepath.Join(g.OutputDir, page.File)) == page.Hash
+}
+
+// reuse copies an unchanged page from the output into the build
+func (g *GitHubPagesGenerator) reuse(target string, page CachedPage) {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	data, err := os.ReadFile(filepath.Join(g.OutputDir, page.File))
+	if err == nil {
+		outputFile := filepath.Join(g.buildDir, page.File)
+		if err = os.MkdirAll(filepath.Dir(outputFile), 0755); err == nil {
+			err = os.WriteFile(outputFile, data, 0644)
 		}
+	}
+	if err != nil {
+		g.fail(req, fmt.Errorf("failed to reuse %s: %v", page.File, err))
+		return
+	}
+	fmt.Printf("Unchanged %s\n", filepath.Join(g.OutputDir, page.File))
+	g.report.Pages++
+	g.report.Reused++
 
-		fmt.Printf("Generated %s\n", ruOutputFile)
+	for _, link := range page.Links {
+		g.enqueue(link, req.URL.Path)
 	}
+	if p, ok := g.pages[req.URL.Path]; ok {
+		g.site.SymbolReport.add(p.page.Path, page.Symbols)
+	}
+	g.next.Pages[target] = page
+}
+
+// fail records a page that could not be generated
+func (g *GitHubPagesGenerator) fail(req *http.Request, err error) {
+	failure := PageError{
+		URL:        req.URL.String(),
+		LinkedFrom: g.linkedFrom[req.URL.String()],
+		Error:      err.Error(),
+	}
+	template := ""
+	if p, ok := g.pages[req.URL.Path]; ok {
+		failure.Page = p.page.Name
+		failure.Lang = p.lang
+		template = g.site.templateFile(p.page, p.lang)
+	}
+	failure.locate(template, g.site.templateFiles)
+	g.report.Failures = append(g.report.Failures, failure)
+	fmt.Printf("Failed to generate %s: %v\n", req.URL, err)
 }
 
 // generateRedirect creates a simple HTML redirect page
-func (g *GitHubPagesGenerator) generateRedirect(outputPath, target string) {
+func (g *GitHubPagesGenerator) generateRedirect(outputPath, target string) error {
 	// Create redirect HTML
 	redirectHTML := `<!DOCTYPE html>
 <html>
@@ -165,13 +459,17 @@ func (g *GitHubPagesGenerator) generateRedirect(outputPath, target string) {
 </html>`
 
 	// Create output file
-	outputFile := filepath.Join(g.OutputDir, outputPath)
+	outputFile := filepath.Join(g.buildDir, outputPath)
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", outputPath, err)
+	}
 	err := os.WriteFile(outputFile, []byte(redirectHTML), 0644)
 	if err != nil {
-		log.Fatalf("Failed to create redirect file %s: %v", outputFile, err)
+		return fmt.Errorf("failed to create redirect file %s: %v", outputPath, err)
 	}
 
-	fmt.Printf("Generated redirect from %s to %s\n", outputFile, target)
+	fmt.Printf("Generated redirect from %s to %s\n", filepath.Join(g.OutputDir, outputPath), target)
+	return nil
 }
 
 // copyDirectory recursively copies a directory tree
@@ -212,205 +510,76 @@ func (g *GitHubPagesGenerator) copyDirectory(src string, dst string) error {
 	return nil
 }
 
-// fixLanguageLinks modifies the generated HTML files to make language switching work with static files
-func (g *GitHubPagesGenerator) fixLanguageLinks() {
-	fmt.Println("Fixing language links for GitHub Pages...")
-
-	// Process all HTML files in the output directory
-	err := filepath.Walk(g.OutputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() && filepath.Ext(path) == ".html" {
-			// Read file
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("error reading file %s: %v", path, err)
-			}
-
-			fileContent := string(content)
-			isRussian := strings.Contains(path, "_ru.html")
-
-			// Fix base URL tag which might not be rendering correctly
-			fileContent = strings.Replace(fileContent,
-				`<meta charset="UTF-8">
-    <base href="{{ .BaseURL }}">`,
-				`<meta charset="UTF-8">
-    <base href="/">`,
-				-1)
-
-			// Replace the switchLanguage function with a completely rewritten version for GitHub Pages
-			switchFunctionPattern := `function switchLanguage\(\) \{[\s\S]*?window\.location\.href = [\s\S]*?\}`
-			newSwitchFunction := `function switchLanguage() {
-    // Get the current path and check if we're on a Russian page
-    const path = window.location.pathname;
-    const isRussian = path.includes('_ru.html');
-    
-    // Determine the new path
-    let newPath;
-    if (isRussian) {
-        // Switch from Russian to English
-        newPath = path.replace('_ru.html', '.html');
-    } else {
-        // Switch from English to Russian
-        newPath = path.replace('.html', '_ru.html');
-    }
-    
-    // Handle special case for index page
-    if (path === '/' || path === '/index.html') {
-        newPath = '/index_ru.html';
-    } else if (path === '/index_ru.html') {
-        newPath = '/index.html';
-    }
-    
-    // Handle case for paths ending with slash
-    if (path.endsWith('/')) {
-        if (isRussian) {
-            newPath = path + 'index.html';
-        } else {
-            newPath = path + 'index_ru.html';
-        }
-    }
-    
-    console.log('Switching language from', path, 'to', newPath);
-    window.location.href = newPath;
-}`
-
-			// Use regex to find and replace the switchLanguage function
-			re := regexp.MustCompile(switchFunctionPattern)
-			fileContent = re.ReplaceAllString(fileContent, newSwitchFunction)
-
-			// Clean up any duplicated debug messages
-			fileContent = strings.Replace(fileContent,
-				`">
-    // Debug message for language switching
-    console.log("Language switching is set up. Current path:", window.location.pathname);
-</script>`,
-				`"></script>`,
-				-1)
-
-			// Replace dynamic links with static ones for both language versions
-			if isRussian {
-				// For Russian pages, ensure links point to Russian versions
-				fileContent = replaceLink(fileContent, `href="/"`, `href="/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/?lang=ru{{else}}/{{end}}"`, `href="/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/features?lang=ru{{else}}/features{{end}}"`, `href="/features/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/examples?lang=ru{{else}}/examples{{end}}"`, `href="/examples/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/docs?lang=ru{{else}}/docs{{end}}"`, `href="/docs/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/download?lang=ru{{else}}/download{{end}}"`, `href="/download/index_ru.html"`)
-
-				// Fix subproject links
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-graphics?lang=ru{{else}}/subprojects/mr-graphics{{end}}"`, `href="/subprojects/mr-graphics/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-math?lang=ru{{else}}/subprojects/mr-math{{end}}"`, `href="/subprojects/mr-math/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-importer?lang=ru{{else}}/subprojects/mr-importer{{end}}"`, `href="/subprojects/mr-importer/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-contractor?lang=ru{{else}}/subprojects/mr-contractor{{end}}"`, `href="/subprojects/mr-contractor/index_ru.html"`)
-			} else {
-				// For English pages, ensure links point to English versions
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/?lang=ru{{else}}/{{end}}"`, `href="/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/features?lang=ru{{else}}/features{{end}}"`, `href="/features/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/examples?lang=ru{{else}}/examples{{end}}"`, `href="/examples/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/docs?lang=ru{{else}}/docs{{end}}"`, `href="/docs/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/download?lang=ru{{else}}/download{{end}}"`, `href="/download/index.html"`)
-
-				// Fix subproject links
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-graphics?lang=ru{{else}}/subprojects/mr-graphics{{end}}"`, `href="/subprojects/mr-graphics/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-math?lang=ru{{else}}/subprojects/mr-math{{end}}"`, `href="/subprojects/mr-math/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-importer?lang=ru{{else}}/subprojects/mr-importer{{end}}"`, `href="/subprojects/mr-importer/index.html"`)
-				fileContent = replaceLink(fileContent, `href="{{if eq .Lang "ru"}}/subprojects/mr-contractor?lang=ru{{else}}/subprojects/mr-contractor{{end}}"`, `href="/subprojects/mr-contractor/index.html"`)
-			}
+// BuildOptions are the command line settings of a static site build
+type BuildOptions struct {
+	OutputDir  string
+	ReportPath string // Where to write the JSON build report, if anywhere
+	Jobs       int    // Pages rendered at the same time, 0 for one per CPU
+	Force      bool   // Render every page instead of reusing unchanged ones
+}
 
-			// Fix any direct links that might have been added during the page generation process
-			// These would be links with no templates that need to be fixed for GitHub Pages
-			if isRussian {
-				// Fix standard links that have ?lang=ru format to use index_ru.html format
-				fileContent = replaceLink(fileContent, `href="/?lang=ru"`, `href="/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/features?lang=ru"`, `href="/features/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/examples?lang=ru"`, `href="/examples/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/docs?lang=ru"`, `href="/docs/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/download?lang=ru"`, `href="/download/index_ru.html"`)
-
-				// Fix subproject links
-				fileContent = replaceLink(fileContent, `href="/subprojects/mr-graphics?lang=ru"`, `href="/subprojects/mr-graphics/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/subprojects/mr-math?lang=ru"`, `href="/subprojects/mr-math/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/subprojects/mr-importer?lang=ru"`, `href="/subprojects/mr-importer/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/subprojects/mr-contractor?lang=ru"`, `href="/subprojects/mr-contractor/index_ru.html"`)
-
-				fileContent = replaceLink(fileContent, `href="/examples"`, `href="/examples/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/features"`, `href="/features/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/docs"`, `href="/docs/index_ru.html"`)
-				fileContent = replaceLink(fileContent, `href="/download"`, `href="/download/index_ru.html"`)
-			} else {
-				fileContent = replaceLink(fileContent, `href="/examples"`, `href="/examples/index.html"`)
-				fileContent = replaceLink(fileContent, `href="/features"`, `href="/features/index.html"`)
-				fileContent = replaceLink(fileContent, `href="/docs"`, `href="/docs/index.html"`)
-				fileContent = replaceLink(fileContent, `href="/download"`, `href="/download/index.html"`)
-			}
+// GenerateGitHubPages builds the static site
+func GenerateGitHubPages(config Config, options BuildOptions) error {
+	generator, err := NewGitHubPagesGenerator(config, options.OutputDir)
+	if err != nil {
+		return err
+	}
+	generator.ReportPath = options.ReportPath
+	generator.Force = options.Force
+	if options.Jobs > 0 {
+		generator.Jobs = options.Jobs
+	}
+	if err := generator.Run(); err != nil {
+		return err
+	}
+	fmt.Println()
+	generator.report.Changes.Print(generator.OutputDir)
 
-			// Fix language switch button visibility
-			// Make sure it displays the correct flag and text
-			if isRussian {
-				fileContent = strings.Replace(fileContent,
-					`{{if eq .Lang "en"}}🇷🇺{{else}}🇺🇸{{end}}`,
-					`🇺🇸`,
-					-1)
-				fileContent = strings.Replace(fileContent,
-					`{{template "lang.switch" .}}`,
-					`English`,
-					-1)
-			} else {
-				fileContent = strings.Replace(fileContent,
-					`{{if eq .Lang "en"}}🇷🇺{{else}}🇺🇸{{end}}`,
-					`🇷🇺`,
-					-1)
-				fileContent = strings.Replace(fileContent,
-					`{{template "lang.switch" .}}`,
-					`Русский`,
-					-1)
-			}
+	fmt.Println("\nStatic site generation complete!")
+	fmt.Println("\nTo deploy to GitHub Pages:")
+	fmt.Println("1. Create a GitHub repository")
+	fmt.Println("2. Commit and push your code including the 'docs' directory")
+	fmt.Println("3. Go to repository Settings -> Pages")
+	fmt.Println("4. Under 'Source', select 'Deploy from a branch'")
+	fmt.Println("5. Select 'main' branch and '/docs' folder, then click 'Save'")
+	fmt.Println("\nYour site will be available at https://yourusername.github.io/repository-name/")
+	return nil
+}
 
-			// Add a prominent debug message at the top of the page
-			fileContent = strings.Replace(fileContent,
-				`<body class="bg-white text-black">`,
-				`<body class="bg-white text-black">
-    <script>
-        console.log("Page language: `+getLanguageDisplay(isRussian)+`");
-        console.log("Current path:", window.location.pathname);
-    </script>`,
-				-1)
-
-			// Write modified content back to file
-			err = os.WriteFile(path, []byte(fileContent), 0644)
-			if err != nil {
-				return fmt.Errorf("error writing file %s: %v", path, err)
-			}
+// VerifyReproducible builds the static site twice from scratch in
+// temporary directories and fails if any file differs between the builds
+func VerifyReproducible(config Config, jobs int) error {
+	dir, err := os.MkdirTemp("", "mr-website-reproducible-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
 
-			fmt.Printf("Fixed language links in %s\n", path)
+	outputs := []string{filepath.Join(dir, "first"), filepath.Join(dir, "second")}
+	for _, output := range outputs {
+		generator, err := NewGitHubPagesGenerator(config, output)
+		if err != nil {
+			return err
 		}
+		generator.NoCache = true
+		if jobs > 0 {
+			generator.Jobs = jobs
+		}
+		if err := generator.Run(); err != nil {
+			return err
+		}
+	}
 
-		return nil
-	})
-
+	changes, err := diffOutputs(outputs[0], outputs[1])
 	if err != nil {
-		log.Fatalf("Error fixing language links: %v", err)
+		return err
 	}
-}
-
-// Helper function for language display
-func getLanguageDisplay(isRussian bool) string {
-	if isRussian {
-		return "Russian"
+	fmt.Println()
+	if differ := len(changes.Added) + len(changes.Changed) + len(changes.Removed); differ > 0 {
+		fmt.Println("The second build differs from the first:")
+		changes.Print(outputs[1])
+		return fmt.Errorf("%d files differ between two builds", differ)
 	}
-	return "English"
-}
-
-// Helper function to replace links without duplicating code
-func replaceLink(content, oldLink, newLink string) string {
-	return strings.Replace(content, oldLink, newLink, -1)
-}
-
-// Generate GitHub Pages version
-func GenerateGitHubPages() {
-	generator := NewGitHubPagesGenerator()
-	generator.Run()
+	fmt.Println("Both builds are identical.")
+	return nil
 }
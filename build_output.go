@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// The static site is built in a temporary directory next to the output and
+// only replaces it once every page was generated, so a failed or aborted
+// build leaves the published site as it was. Replacing the whole directory
+// also drops the files of pages that no longer exist.
+
+// preservedFiles are kept from the previous output although the generator
+// does not produce them, such as the custom domain of GitHub Pages
+var preservedFiles = []string{"CNAME"}
+
+// newBuildDir creates the temporary directory a build of outputDir is
+// written to. It is a sibling of the output so that it can be renamed into
+// place.
+func newBuildDir(outputDir string) (string, error) {
+	parent := filepath.Dir(filepath.Clean(outputDir))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(parent, "."+filepath.Base(filepath.Clean(outputDir))+"-build-")
+	if err != nil {
+		return "", err
+	}
+	return dir, os.Chmod(dir, 0755)
+}
+
+// buildDirPattern matches the build directories of outputDir
+func buildDirPattern(outputDir string) string {
+	outputDir = filepath.Clean(outputDir)
+	return filepath.Join(filepath.Dir(outputDir), "."+filepath.Base(outputDir)+"-build-*")
+}
+
+// OutputChanges lists the files a build added to, changed in and removed
+// from the output, relative to it
+type OutputChanges struct {
+	Added   []string `json:"added"`
+	Changed []string `json:"changed"`
+	Removed []string `json:"removed"`
+}
+
+// diffOutputs compares the files of the previous output with a new build
+func diffOutputs(oldDir, newDir string) (OutputChanges, error) {
+	var changes OutputChanges
+	before, err := outputHashes(oldDir)
+	if err != nil {
+		return changes, err
+	}
+	after, err := outputHashes(newDir)
+	if err != nil {
+		return changes, err
+	}
+
+	for _, file := range sortedKeys(after) {
+		hash, ok := before[file]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, file)
+		case hash != after[file]:
+			changes.Changed = append(changes.Changed, file)
+		}
+	}
+	for _, file := range sortedKeys(before) {
+		if _, ok := after[file]; !ok {
+			changes.Removed = append(changes.Removed, file)
+		}
+	}
+	return changes, nil
+}
+
+// outputHashes returns the hash of every file below dir, which may not exist
+func outputHashes(dir string) (map[string][sha256.Size]byte, error) {
+	hashes := make(map[string][sha256.Size]byte)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == dir {
+			return filepath.SkipDir
+		}
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hashes[filepath.ToSlash(rel)] = sha256.Sum256(data)
+		return nil
+	})
+	return hashes, err
+}
+
+// Print lists the changes to the output
+func (c OutputChanges) Print(outputDir string) {
+	if len(c.Added)+len(c.Changed)+len(c.Removed) == 0 {
+		fmt.Printf("No changes to %s\n", outputDir)
+		return
+	}
+	fmt.Printf("Changes to %s:\n", outputDir)
+	for _, file := range c.Added {
+		fmt.Printf("  + %s\n", file)
+	}
+	for _, file := range c.Changed {
+		fmt.Printf("  ~ %s\n", file)
+	}
+	for _, file := range c.Removed {
+		fmt.Printf("  - %s\n", file)
+	}
+	fmt.Printf("%d added, %d changed, %d removed\n", len(c.Added), len(c.Changed), len(c.Removed))
+}
+
+// copyPreserved copies the preserved files of the previous output into a
+// new build
+func copyPreserved(outputDir, buildDir string) error {
+	for _, name := range preservedFiles {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(buildDir, name), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceOutput moves a finished build into the place of the output. The
+// previous output is moved aside first and restored if the build cannot
+// take its place, so the output is never left half-written.
+//
+// These are two renames, since portable Go has no way to exchange two
+// directories in one step: if the process dies between them, the output is
+// missing and the previous one waits beside it. The next build puts it back
+// before it starts, see recoverOutput.
+func replaceOutput(buildDir, outputDir string) error {
+	old := oldOutputDir(outputDir)
+	_, err := os.Stat(outputDir)
+	exists := err == nil
+	if exists {
+		if err := os.Rename(outputDir, old); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(buildDir, outputDir); err != nil {
+		if exists {
+			os.Rename(old, outputDir)
+		}
+		return err
+	}
+	if exists {
+		return os.RemoveAll(old)
+	}
+	return nil
+}
+
+// oldOutputDir returns where replaceOutput keeps the previous output while
+// the build takes its place
+func oldOutputDir(outputDir string) string {
+	outputDir = filepath.Clean(outputDir)
+	return filepath.Join(filepath.Dir(outputDir), "."+filepath.Base(outputDir)+"-old")
+}
+
+// recoverOutput cleans up after builds that were interrupted. It removes
+// their build directories and finishes a replacement of the output: if the
+// output is missing, the previous one set aside is moved back, otherwise a
+// previous one that outlived the replacement is removed. It reports whether
+// the output was restored.
+func recoverOutput(outputDir string) (bool, error) {
+	stale, err := filepath.Glob(buildDirPattern(outputDir))
+	if err != nil {
+		return false, err
+	}
+	for _, dir := range stale {
+		if err := os.RemoveAll(dir); err != nil {
+			return false, err
+		}
+	}
+
+	old := oldOutputDir(outputDir)
+	if _, err := os.Stat(old); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if _, err := os.Stat(outputDir); errors.Is(err, fs.ErrNotExist) {
+		return true, os.Rename(old, outputDir)
+	}
+	return false, os.RemoveAll(old)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BuildReport summarises a static site build. It is printed at the end of
+// the build and, for CI, written as JSON with --report.
+type BuildReport struct {
+	Pages     int         `json:"pages"`     // Pages written
+	Reused    int         `json:"reused"`    // Pages copied unchanged from the previous build
+	Redirects int         `json:"redirects"` // Redirect stubs written
+	Failures  []PageError `json:"failures"`
+
+	// Files the build added to, changed in and removed from the output, set
+	// once it replaced the output
+	Changes OutputChanges `json:"changes"`
+}
+
+// PageError is a page that could not be generated
+type PageError struct {
+	URL        string `json:"url"`
+	Page       string `json:"page,omitempty"` // Name in the page table
+	Lang       string `json:"lang,omitempty"`
+	Template   string `json:"template,omitempty"` // File the error is in
+	Line       int    `json:"line,omitempty"`
+	LinkedFrom string `json:"linkedFrom,omitempty"` // Page the crawler found the URL on
+	Error      string `json:"error"`
+}
+
+// errorLocation finds the file and line in errors of templates, such as
+// "template: features.html:12:5: executing ...", and of Markdown pages
+var errorLocation = regexp.MustCompile(`([\w./-]+\.(?:html|md)):([0-9]+)`)
+
+// locate fills in the template and line of the error from its message,
+// falling back to the template of the page. Templates are named after their
+// file without the directory, so names are resolved against the page's
+// template and then the other template files of the site.
+func (e *PageError) locate(template string, files []string) {
+	e.Template = template
+	m := errorLocation.FindStringSubmatch(e.Error)
+	if m == nil {
+		return
+	}
+	e.Line, _ = strconv.Atoi(m[2])
+	e.Template = m[1]
+	switch {
+	case strings.Contains(m[1], "/"):
+	case m[1] == filepath.Base(template):
+		e.Template = template
+	default:
+		for _, file := range files {
+			if m[1] == filepath.Base(file) {
+				e.Template = file
+				break
+			}
+		}
+	}
+}
+
+// OK reports whether every page was generated
+func (r *BuildReport) OK() bool {
+	return len(r.Failures) == 0
+}
+
+// sort orders the failures by URL
+func (r *BuildReport) sort() {
+	sort.Slice(r.Failures, func(i, j int) bool {
+		return r.Failures[i].URL < r.Failures[j].URL
+	})
+}
+
+// Print lists the failed pages in a human readable form
+func (r *BuildReport) Print() {
+	r.sort()
+	fmt.Printf("%d pages failed:\n", len(r.Failures))
+	for _, f := range r.Failures {
+		fmt.Printf("  %s\n", f.URL)
+		var where []string
+		if f.Template != "" {
+			where = append(where, "template "+f.Template)
+		}
+		if f.Line > 0 {
+			where = append(where, fmt.Sprintf("line %d", f.Line))
+		}
+		if f.Lang != "" {
+			where = append(where, "language "+f.Lang)
+		}
+		if f.LinkedFrom != "" {
+			where = append(where, "linked from "+f.LinkedFrom)
+		}
+		if len(where) > 0 {
+			fmt.Printf("    %s\n", strings.Join(where, ", "))
+		}
+		fmt.Printf("    %s\n", f.Error)
+	}
+}
+
+// Write saves the report as JSON
+func (r *BuildReport) Write(path string) error {
+	r.sort()
+	// Empty lists rather than null for scripts
+	if r.Failures == nil {
+		r.Failures = []PageError{}
+	}
+	for _, files := range []*[]string{&r.Changes.Added, &r.Changes.Changed, &r.Changes.Removed} {
+		if *files == nil {
+			*files = []string{}
+		}
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pages take time-derived values, such as the copyright year, from one build
+// clock instead of the wall clock, so that building the same sources again
+// gives the same bytes. The clock follows the SOURCE_DATE_EPOCH convention
+// of reproducible builds and otherwise stands at the last commit.
+
+// buildTime returns the time the site is built at and where it comes from:
+// SOURCE_DATE_EPOCH if set, else the time of the last git commit, else the
+// current time outside of git
+func buildTime() (time.Time, string, error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", epoch, err)
+		}
+		return time.Unix(seconds, 0).UTC(), "SOURCE_DATE_EPOCH", nil
+	}
+
+	out, err := exec.Command("git", "log", "-1", "--format=%ct").Output()
+	if err == nil {
+		if seconds, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC(), "last commit", nil
+		}
+	}
+	return time.Now().UTC(), "current time", nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config holds the site settings shared by the server and the generator
+type Config struct {
+	// BasePath is the URL prefix the site is served under, e.g. "/mr-website/"
+	// for a GitHub project page. Defaults to "/".
+	BasePath string `json:"basePath"`
+
+	// Locales lists the languages the site is rendered in. The first one is
+	// the default language. Each locale needs a catalog in locales/<code>.json.
+	Locales []Locale `json:"locales"`
+
+	// API maps module names to the Doxygen XML output of a local checkout
+	// (the directory holding index.xml) that the API reference is built from
+	API map[string]string `json:"api,omitempty"`
+
+	// Sources maps module names to local checkouts that code snippets are
+	// included from
+	Sources map[string]string `json:"sources,omitempty"`
+}
+
+// Locale describes one language of the site
+type Locale struct {
+	Code string `json:"code"` // Language tag used in URLs, file names and <html lang>
+	Name string `json:"name"` // Name of the language in the language itself
+	Flag string `json:"flag"` // Emoji shown in the language picker
+}
+
+// defaultLocales are used when the configuration does not list any
+var defaultLocales = []Locale{
+	{Code: "en", Name: "English", Flag: "🇺🇸"},
+	{Code: "ru", Name: "Русский", Flag: "🇷🇺"},
+}
+
+// LoadConfig reads the configuration file. A missing file yields the defaults.
+func LoadConfig(path string) (Config, error) {
+	config := Config{BasePath: "/", Locales: defaultLocales}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	config.BasePath = normalizeBasePath(config.BasePath)
+	if len(config.Locales) == 0 {
+		config.Locales = defaultLocales
+	}
+	for _, locale := range config.Locales {
+		if locale.Code == "" {
+			return config, fmt.Errorf("error parsing %s: locale without a code", path)
+		}
+	}
+	return config, nil
+}
+
+// normalizeBasePath makes sure the base path starts and ends with a slash
+func normalizeBasePath(basePath string) string {
+	basePath = strings.Trim(basePath, "/")
+	if basePath == "" {
+		return "/"
+	}
+	return "/" + basePath + "/"
+}
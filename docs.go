@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// docsDir holds the documentation guides. Every directory is a section of
+// the sidebar, described by its index.<lang>.md, and every other Markdown
+// file is a guide in it:
+//
+//	content/docs/index.en.md                   /docs/
+//	content/docs/getting-started.en.md         /docs/getting-started/
+//	content/docs/mr-math/index.en.md           /docs/mr-math/
+//	content/docs/mr-math/vectors.en.md         /docs/mr-math/vectors/
+//
+// The root index is the "docs" entry of the page table.
+//
+// A section whose subdirectories are named after versions keeps one copy of
+// its guides per release of the module:
+//
+//	content/docs/mr-graphics/v0.3/index.en.md   /docs/mr-graphics/
+//	content/docs/mr-graphics/v0.2/index.en.md   /docs/mr-graphics/v0.2/
+//
+// The newest version keeps the routes of the section, so links to it stay
+// valid across releases, and is also reachable under
+// /docs/mr-graphics/latest/ and /docs/mr-graphics/v0.3/, which redirect to
+// it. Module pages are versioned the same way in the page table, see
+// versions.go.
+const docsDir = "content/docs"
+
+// versionPattern matches the directory names of versioned sections
+var versionPattern = regexp.MustCompile(`^v[0-9]+(\.[0-9]+)*$`)
+
+// docsTemplate renders documentation pages unless the front matter names
+// another template
+const docsTemplate = "docs.html"
+
+// DocNode is a guide or section in the documentation tree
+type DocNode struct {
+	Page     string // Name of the page, empty for sections without an index
+	Path     string // Route, e.g. /docs/mr-math
+	Name     string // File or directory name, the title of last resort
+	Order    int    // Order among siblings, from the front matter
+	Children []*DocNode
+
+	Version  string     // Set on the root of each version of a versioned section
+	Versions []*DocNode // Versions of a versioned section, newest first
+}
+
+// loadDocs scans the documentation tree. It returns the pages of all guides
+// and sections below the root, to be served in addition to the page table,
+// and the tree the sidebar is built from.
+func loadDocs(dir string) ([]Page, *DocNode, error) {
+	root := &DocNode{Page: "docs", Path: "/docs", Name: "docs"}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, root, nil
+	}
+
+	var docPages []Page
+	err := loadDocsDir(dir, root, &docPages)
+	return docPages, root, err
+}
+
+// loadDocsDir adds the guides and sections of one directory to node
+func loadDocsDir(dir string, node *DocNode, docPages *[]Page) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	// The newest version is served at the route of the section
+	newest := ""
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !versionPattern.MatchString(name) {
+			continue
+		}
+		if newest == "" || compareVersions(name, newest) > 0 {
+			newest = name
+		}
+	}
+
+	guides := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() && versionPattern.MatchString(name) {
+			version := &DocNode{Path: path.Join(node.Path, name), Name: node.Name, Version: name}
+			if name == newest {
+				version.Path = node.Path
+			}
+			if err := loadDocsDir(filepath.Join(dir, name), version, docPages); err != nil {
+				return err
+			}
+			node.Versions = append(node.Versions, version)
+			continue
+		}
+		if entry.IsDir() {
+			child := &DocNode{Path: path.Join(node.Path, name), Name: name}
+			if err := loadDocsDir(filepath.Join(dir, name), child, docPages); err != nil {
+				return err
+			}
+			node.Children = append(node.Children, child)
+			continue
+		}
+
+		// mr-math.en.md and mr-math.md are versions of the guide mr-math
+		base, ok := strings.CutSuffix(name, ".md")
+		if !ok {
+			continue
+		}
+		if lang := markdownLanguage(name); lang != "" {
+			base = strings.TrimSuffix(base, "."+lang)
+		}
+		guides[base] = true
+	}
+
+	for _, base := range sortedKeys(guides) {
+		content := filepath.Join(dir, base)
+		source, err := LoadMarkdownPages(content)
+		if err != nil {
+			return err
+		}
+		order := source[sourceLanguage].Order
+
+		// The index describes the directory itself
+		if base == "index" {
+			node.Order = order
+			if node.Page == "" {
+				node.Page = strings.TrimPrefix(node.Path, "/")
+				*docPages = append(*docPages, docPage(node.Page, node.Path, filepath.ToSlash(content)))
+			}
+			continue
+		}
+
+		route := path.Join(node.Path, base)
+		page := strings.TrimPrefix(route, "/")
+		*docPages = append(*docPages, docPage(page, route, filepath.ToSlash(content)))
+		node.Children = append(node.Children, &DocNode{Page: page, Path: route, Name: base, Order: order})
+	}
+
+	if len(node.Versions) > 0 {
+		if len(guides) > 0 || len(node.Children) > 0 {
+			return fmt.Errorf("%s: versioned sections keep all guides in their version directories", dir)
+		}
+		sort.Slice(node.Versions, func(i, j int) bool {
+			return compareVersions(node.Versions[i].Version, node.Versions[j].Version) > 0
+		})
+		node.Order = node.Versions[0].Order
+		*docPages = append(*docPages, latestAliases(node)...)
+		return nil
+	}
+
+	sort.Slice(node.Children, func(i, j int) bool {
+		a, b := node.Children[i], node.Children[j]
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return a.Name < b.Name
+	})
+	return nil
+}
+
+// docPage returns the page entry of a guide
+func docPage(name, route, content string) Page {
+	return Page{
+		Name:    name,
+		Path:    route,
+		Content: content,
+		Output:  strings.TrimPrefix(route, "/"),
+	}
+}
+
+// latestAliases returns the redirects from the latest/ and versioned routes
+// of the newest version of a section to the routes it is served at
+func latestAliases(node *DocNode) []Page {
+	latest := node.Versions[0]
+	var aliases []Page
+	for _, guide := range latest.flatten("") {
+		rel := strings.TrimPrefix(guide.Path, latest.Path)
+		for _, alias := range []string{node.Path + "/latest" + rel, node.Path + "/" + latest.Version + rel} {
+			aliases = append(aliases, Page{
+				Name:     strings.TrimPrefix(alias, "/"),
+				Path:     alias,
+				Output:   strings.TrimPrefix(alias, "/"),
+				Redirect: guide.Path,
+			})
+		}
+	}
+	return aliases
+}
+
+// flatten returns the pages of the tree in reading order. Versioned sections
+// contribute the version the current page belongs to, or else their newest.
+func (n *DocNode) flatten(current string) []*DocNode {
+	if len(n.Versions) > 0 {
+		return n.pick(current).flatten(current)
+	}
+
+	var nodes []*DocNode
+	if n.Page != "" {
+		nodes = append(nodes, n)
+	}
+	for _, child := range n.Children {
+		nodes = append(nodes, child.flatten(current)...)
+	}
+	return nodes
+}
+
+// all returns every page of the tree, including all versions
+func (n *DocNode) all() []*DocNode {
+	var nodes []*DocNode
+	if n.Page != "" {
+		nodes = append(nodes, n)
+	}
+	for _, child := range append(n.Children, n.Versions...) {
+		nodes = append(nodes, child.all()...)
+	}
+	return nodes
+}
+
+// pick returns the version of a versioned section that contains the page,
+// or the newest one
+func (n *DocNode) pick(page string) *DocNode {
+	for _, version := range n.Versions {
+		for _, node := range version.all() {
+			if node.Page == page {
+				return version
+			}
+		}
+	}
+	return n.Versions[0]
+}
+
+// versionOf finds the versioned section and version a page belongs to
+func (n *DocNode) versionOf(page string) (section, version *DocNode, ok bool) {
+	if len(n.Versions) > 0 {
+		version := n.pick(page)
+		for _, node := range version.all() {
+			if node.Page == page {
+				return n, version, true
+			}
+		}
+		return nil, nil, false
+	}
+	for _, child := range n.Children {
+		if section, version, ok := child.versionOf(page); ok {
+			return section, version, true
+		}
+	}
+	return nil, nil, false
+}
+
+// DocLink is a link in the documentation navigation
+type DocLink struct {
+	Title    string
+	URL      string
+	Active   bool // Link to the page being shown
+	Children []DocLink
+}
+
+// DocNav is the navigation around a documentation page
+type DocNav struct {
+	Sidebar    DocLink
+	Prev, Next *DocLink
+	TOC        []TOCEntry
+}
+
+// docNav builds the navigation of a documentation page in the given language
+func (s *Site) docNav(p Page, lang string) *DocNav {
+	nodes := s.docs.flatten(p.Name)
+	for i, node := range nodes {
+		if node.Page != p.Name {
+			continue
+		}
+
+		nav := &DocNav{Sidebar: s.docLink(s.docs, p.Name, lang), TOC: s.toc[p.Name][lang]}
+		if i > 0 {
+			nav.Prev = &DocLink{Title: s.docTitle(nodes[i-1], lang), URL: s.URL(nodes[i-1].Path, lang)}
+		}
+		if i+1 < len(nodes) {
+			nav.Next = &DocLink{Title: s.docTitle(nodes[i+1], lang), URL: s.URL(nodes[i+1].Path, lang)}
+		}
+		return nav
+	}
+	return nil
+}
+
+// docLink turns a node and its children into links, marking the active page
+func (s *Site) docLink(n *DocNode, active, lang string) DocLink {
+	if len(n.Versions) > 0 {
+		return s.docLink(n.pick(active), active, lang)
+	}
+
+	link := DocLink{Title: s.docTitle(n, lang), Active: n.Page != "" && n.Page == active}
+	if n.Page != "" {
+		link.URL = s.URL(n.Path, lang)
+	}
+	for _, child := range n.Children {
+		link.Children = append(link.Children, s.docLink(child, active, lang))
+	}
+	return link
+}
+
+// docTitle returns the title of a guide or section in the given language
+func (s *Site) docTitle(n *DocNode, lang string) string {
+	if title := s.markdown[n.Page][lang].Title; title != "" {
+		return title
+	}
+	return n.Name
+}
+
+// TOCEntry is a heading listed in the table of contents of a page
+type TOCEntry struct {
+	Level int // 2 for ## headings, 3 for ###
+	ID    string
+	Title string
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/util"
+)
+
+// Code blocks are highlighted when a page is rendered, so they need neither
+// JavaScript nor a CDN: by codeRenderer on Markdown pages, by apiHTML in the
+// API reference and by the Code and Snippet helpers of templates. Tokens get chroma's short CSS classes (k for
+// keywords, n for names and so on), styled by /css/highlight.css.
+
+// highlightCSSRoute serves the stylesheet of highlighted code
+const highlightCSSRoute = "/css/highlight.css"
+
+// Code is shown in a dark theme like the rest of the site's code, and in a
+// light one when printed or inside an element with the code-light class
+const (
+	darkCodeStyle  = "github-dark"
+	lightCodeStyle = "github"
+)
+
+// highlightCSS returns the stylesheet of highlighted code with both themes
+func highlightCSS() (string, error) {
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	themes := make(map[string]string)
+	for _, name := range []string{darkCodeStyle, lightCodeStyle} {
+		var b strings.Builder
+		if err := formatter.WriteCSS(&b, styles.Get(name)); err != nil {
+			return "", fmt.Errorf("style %s: %v", name, err)
+		}
+		// Only the rules below .chroma apply to code blocks
+		var rules []string
+		for _, line := range strings.Split(b.String(), "\n") {
+			if strings.Contains(line, ".chroma") {
+				rules = append(rules, line)
+			}
+		}
+		themes[name] = strings.Join(rules, "\n") + "\n"
+	}
+
+	light := themes[lightCodeStyle]
+	return "/* " + darkCodeStyle + " */\n" + themes[darkCodeStyle] +
+		"\n/* " + lightCodeStyle + " */\n" + strings.ReplaceAll(light, ".chroma", ".code-light .chroma") +
+		"\n@media print {\n" + light + "}\n", nil
+}
+
+// handleHighlightCSS serves the stylesheet of highlighted code
+func (s *Site) handleHighlightCSS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Write([]byte(s.highlightCSS))
+}
+
+// highlightCode returns code as HTML with its tokens wrapped in classed
+// spans. Languages chroma does not know are only escaped. If link is set,
+// names such as mr::graphics::Context are looked up as a whole and linked.
+func highlightCode(code, language string, link func(string) string) string {
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		return template.HTMLEscapeString(code)
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return template.HTMLEscapeString(code)
+	}
+
+	var b strings.Builder
+	tokens := iterator.Tokens()
+	for i := 0; i < len(tokens); {
+		if end := qualifiedNameEnd(tokens, i); link != nil && end > i {
+			var name strings.Builder
+			for _, token := range tokens[i:end] {
+				name.WriteString(token.Value)
+			}
+			if url := link(name.String()); url != "" {
+				b.WriteString(`<a href="` + template.HTMLEscapeString(url) + `">`)
+				for _, token := range tokens[i:end] {
+					writeToken(&b, token)
+				}
+				b.WriteString("</a>")
+				i = end
+				continue
+			}
+		}
+		writeToken(&b, tokens[i])
+		i++
+	}
+	return b.String()
+}
+
+// qualifiedNameEnd returns the end of the name that starts at token i, which
+// lexers split into names and :: operators, or i if there is none
+func qualifiedNameEnd(tokens []chroma.Token, i int) int {
+	j := i
+	if tokens[j].Value == "::" {
+		j++
+	}
+	if j >= len(tokens) || !tokens[j].Type.InCategory(chroma.Name) {
+		return i
+	}
+	j++
+	for j+1 < len(tokens) && tokens[j].Value == "::" && tokens[j+1].Type.InCategory(chroma.Name) {
+		j += 2
+	}
+	return j
+}
+
+// writeToken writes a token as a span with the class of its type
+func writeToken(b *strings.Builder, token chroma.Token) {
+	value := template.HTMLEscapeString(token.Value)
+	if class := chroma.StandardTypes[token.Type]; class != "" {
+		b.WriteString(`<span class="` + class + `">` + value + `</span>`)
+		return
+	}
+	b.WriteString(value)
+}
+
+// codeBlock renders code as a highlighted block. The layout's script gives
+// blocks with a language class a header and a copy button. Names in C++
+// code are linked with link; attrs are further attributes of the <pre>.
+func codeBlock(code, language, attrs string, link func(string) string) string {
+	if language == "" {
+		return "<pre" + attrs + "><code>" + template.HTMLEscapeString(code) + "</code></pre>"
+	}
+	if language != "cpp" {
+		link = nil
+	}
+	class := "language-" + template.HTMLEscapeString(language)
+	return `<pre class="chroma ` + class + `"` + attrs + `><code class="` + class + `">` +
+		highlightCode(code, language, link) + "</code></pre>"
+}
+
+// inlineCode renders inline code, linked with link if it is a single C++
+// name such as mr::Vec3f or mr::dot()
+func inlineCode(code string, link func(string) string) string {
+	result := "<code>" + template.HTMLEscapeString(code) + "</code>"
+	if link == nil || !isIdentifier(code) {
+		return result
+	}
+	if url := link(strings.TrimSuffix(code, "()")); url != "" {
+		return `<a href="` + template.HTMLEscapeString(url) + `">` + result + "</a>"
+	}
+	return result
+}
+
+// Code renders a code block written in a template, linking C++ names like
+// those of Markdown pages:
+//
+//	{{.Code "cpp" `auto pipeline = make_pipeline(load_assets());`}}
+func (d PageData) Code(language, code string) template.HTML {
+	link := d.site.symbolResolver(d.Path, d.Lang)
+	return template.HTML(codeBlock(strings.Trim(code, "\n"), language, "", link))
+}
+
+// codeLinksMeta is the document metadata under which renderMarkdown passes
+// the function linking C++ names to codeRenderer
+const codeLinksMeta = "codeLinks"
+
+// codeRenderer renders the code blocks and inline code of Markdown pages
+// with codeBlock and inlineCode in place of goldmark's plain ones
+type codeRenderer struct{}
+
+func (codeRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindFencedCodeBlock, renderCodeBlock)
+	reg.Register(ast.KindCodeBlock, renderCodeBlock)
+	reg.Register(ast.KindCodeSpan, renderCodeSpan)
+}
+
+// codeLinks returns the function linking C++ names in the document of a
+// node, or nil if there is none
+func codeLinks(n ast.Node) func(string) string {
+	link, _ := n.OwnerDocument().Meta()[codeLinksMeta].(func(string) string)
+	return link
+}
+
+func renderCodeBlock(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var code strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		code.Write(segment.Value(source))
+	}
+	language := ""
+	if fenced, ok := n.(*ast.FencedCodeBlock); ok {
+		language = string(fenced.Language(source))
+	}
+	w.WriteString(codeBlock(code.String(), language, "", codeLinks(n)) + "\n")
+	return ast.WalkSkipChildren, nil
+}
+
+func renderCodeSpan(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	var code strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		text, ok := c.(*ast.Text)
+		if !ok {
+			continue
+		}
+		value := text.Segment.Value(source)
+		if bytes.HasSuffix(value, []byte("\n")) {
+			code.Write(value[:len(value)-1])
+			code.WriteByte(' ')
+			continue
+		}
+		code.Write(value)
+	}
+	// Code that is already part of a link is not linked again
+	link := codeLinks(n)
+	for parent := n.Parent(); parent != nil; parent = parent.Parent() {
+		if parent.Kind() == ast.KindLink {
+			link = nil
+		}
+	}
+	w.WriteString(inlineCode(code.String(), link))
+	return ast.WalkSkipChildren, nil
+}
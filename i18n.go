@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sourceLanguage is the language every catalog falls back to
+const sourceLanguage = "en"
+
+// Catalog maps message keys such as "home.subtitle" to the text of one language
+type Catalog map[string]string
+
+// Catalogs holds the message catalogs of every language
+type Catalogs map[string]Catalog
+
+// LoadCatalogs reads one <lang>.json catalog per language from dir
+func LoadCatalogs(dir string, langs []string) (Catalogs, error) {
+	catalogs := make(Catalogs)
+	for _, lang := range langs {
+		path := filepath.Join(dir, lang+".json")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		catalog := make(Catalog)
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+		catalogs[lang] = catalog
+	}
+	return catalogs, nil
+}
+
+// SourceHashes maps the message keys of one language to the hash of the
+// source language text they were translated from
+type SourceHashes map[string]string
+
+// sourceHashesFile returns the file recording the source hashes of a language
+func sourceHashesFile(dir, lang string) string {
+	return filepath.Join(dir, lang+".sources.json")
+}
+
+// LoadSourceHashes reads the <lang>.sources.json file of every language from
+// dir. A language without the file has no translations recorded yet.
+func LoadSourceHashes(dir string, langs []string) (map[string]SourceHashes, error) {
+	hashes := make(map[string]SourceHashes)
+	for _, lang := range langs {
+		path := sourceHashesFile(dir, lang)
+		recorded := make(SourceHashes)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			hashes[lang] = recorded
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &recorded); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+		hashes[lang] = recorded
+	}
+	return hashes, nil
+}
+
+// SaveSourceHashes writes the source hashes of a language to dir
+func SaveSourceHashes(dir, lang string, hashes SourceHashes) error {
+	return writeJSON(sourceHashesFile(dir, lang), hashes)
+}
+
+// writeJSON writes a map in the format of the catalogs: sorted keys, four
+// space indentation and no escaping of HTML or non-ASCII text
+func writeJSON(path string, value any) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// sourceHash returns the hash identifying a version of a source text
+func sourceHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StaleKeys returns the translated keys of a language whose source text has
+// changed since they were translated, or that were never recorded at all
+func (c Catalogs) StaleKeys(lang string, hashes SourceHashes) []string {
+	var stale []string
+	for key, text := range c[lang] {
+		source, ok := c[sourceLanguage][key]
+		if text == "" || !ok {
+			continue
+		}
+		if hashes[key] != sourceHash(source) {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// MarkTranslated records the current source text of the given keys as the
+// one their translation into lang was made from
+func (c Catalogs) MarkTranslated(lang string, hashes SourceHashes, keys []string) {
+	for _, key := range keys {
+		if source, ok := c[sourceLanguage][key]; ok && c[lang][key] != "" {
+			hashes[key] = sourceHash(source)
+		}
+	}
+}
+
+// Message returns the text of key in the given language, falling back to
+// the source language
+func (c Catalogs) Message(lang, key string) (string, bool) {
+	message, ok := c[lang][key]
+	if !ok || message == "" {
+		message, ok = c[sourceLanguage][key]
+	}
+	return message, ok
+}
+
+// Translate returns the message for key in the given language, falling back
+// to the source language and finally to the key itself. Arguments are given
+// as name/value pairs and replace {name} placeholders in the message.
+func (c Catalogs) Translate(lang, key string, args ...any) template.HTML {
+	message, ok := c.Message(lang, key)
+	if !ok {
+		return template.HTML(template.HTMLEscapeString(key))
+	}
+
+	for i := 0; i+1 < len(args); i += 2 {
+		placeholder := fmt.Sprintf("{%v}", args[i])
+		value := template.HTMLEscapeString(fmt.Sprint(args[i+1]))
+		message = strings.ReplaceAll(message, placeholder, value)
+	}
+	return template.HTML(message)
+}
+
+// negotiateLanguage picks the supported language the Accept-Language header
+// ranks highest. Region subtags are ignored when matching, so "ru-RU" selects
+// "ru". Returns false when nothing matches.
+func negotiateLanguage(header string, supported []string) (string, bool) {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= bestQuality {
+			continue
+		}
+
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		for _, lang := range supported {
+			if primary == strings.ToLower(lang) {
+				best, bestQuality = lang, quality
+				break
+			}
+		}
+	}
+	return best, best != ""
+}
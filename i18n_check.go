@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// MessageUsage records where a message key is referenced
+type MessageUsage struct {
+	Key      string
+	Location string // file:line:col, or a description for non-template sources
+}
+
+// collectMessageKeys finds every message key referenced by the site: literal
+// {{t "key"}} calls in the templates and the page titles. Calls whose key is
+// not a string literal cannot be checked and are returned separately.
+func collectMessageKeys(templateDir string) (used map[string][]MessageUsage, dynamic []string, err error) {
+	used = make(map[string][]MessageUsage)
+
+	err = filepath.WalkDir(templateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+
+		// Parse each file on its own; the helpers are never called, only the
+		// trees matter
+		tmpl, err := template.New(filepath.Base(path)).Funcs((&Site{}).funcs(sourceLanguage, nil)).ParseFiles(path)
+		if err != nil {
+			return err
+		}
+		for _, t := range tmpl.Templates() {
+			if t.Tree == nil || t.Tree.Root == nil {
+				continue
+			}
+			walkNodes(t.Tree.Root, func(cmd *parse.CommandNode) {
+				if len(cmd.Args) < 2 {
+					return
+				}
+				if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "t" {
+					return
+				}
+				location, _ := t.Tree.ErrorContext(cmd)
+				location = filepath.ToSlash(path) + strings.TrimPrefix(location, t.Tree.ParseName)
+				if key, ok := cmd.Args[1].(*parse.StringNode); ok {
+					used[key.Text] = append(used[key.Text], MessageUsage{Key: key.Text, Location: location})
+				} else {
+					dynamic = append(dynamic, location)
+				}
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, p := range pages {
+		if p.Title != "" {
+			used[p.Title] = append(used[p.Title], MessageUsage{Key: p.Title, Location: "title of page " + p.Name})
+		}
+		if p.Content != "" {
+			used[markdownTitleKey] = append(used[markdownTitleKey], MessageUsage{Key: markdownTitleKey, Location: "title of page " + p.Name})
+		}
+	}
+	for _, key := range apiMessageKeys() {
+		used[key] = append(used[key], MessageUsage{Key: key, Location: "api.go"})
+	}
+	return used, dynamic, nil
+}
+
+// walkNodes calls fn for every command in the tree below node
+func walkNodes(node parse.Node, fn func(*parse.CommandNode)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkNodes(child, fn)
+		}
+	case *parse.ActionNode:
+		walkNodes(n.Pipe, fn)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkNodes(cmd, fn)
+		}
+	case *parse.CommandNode:
+		fn(n)
+		for _, arg := range n.Args {
+			walkNodes(arg, fn)
+		}
+	case *parse.IfNode:
+		walkNodes(n.Pipe, fn)
+		walkNodes(n.List, fn)
+		walkNodes(n.ElseList, fn)
+	case *parse.RangeNode:
+		walkNodes(n.Pipe, fn)
+		walkNodes(n.List, fn)
+		walkNodes(n.ElseList, fn)
+	case *parse.WithNode:
+		walkNodes(n.Pipe, fn)
+		walkNodes(n.List, fn)
+		walkNodes(n.ElseList, fn)
+	case *parse.TemplateNode:
+		walkNodes(n.Pipe, fn)
+	}
+}
+
+// I18nReport lists the translation problems found by CheckI18n
+type I18nReport struct {
+	Locales      []string                  // Translated locales that were checked
+	Missing      map[string][]MessageUsage // Used keys absent from the source catalog
+	Unused       []string                  // Source keys nothing references
+	Untranslated map[string][]string       // Per locale: source keys without a translation
+	Obsolete     map[string][]string       // Per locale: keys the source catalog no longer has
+	Stale        map[string][]string       // Per locale: translations of an older source text
+	Dynamic      []string                  // t calls whose key is computed at runtime
+}
+
+// OK reports whether the check found nothing to fix
+func (r I18nReport) OK() bool {
+	if len(r.Missing) > 0 || len(r.Unused) > 0 {
+		return false
+	}
+	for _, keys := range r.Untranslated {
+		if len(keys) > 0 {
+			return false
+		}
+	}
+	for _, keys := range r.Obsolete {
+		if len(keys) > 0 {
+			return false
+		}
+	}
+	for _, keys := range r.Stale {
+		if len(keys) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckI18n compares the templates with the catalogs of every locale
+func CheckI18n(config Config, templateDir, catalogDir string) (I18nReport, error) {
+	report := I18nReport{
+		Missing:      make(map[string][]MessageUsage),
+		Untranslated: make(map[string][]string),
+		Obsolete:     make(map[string][]string),
+		Stale:        make(map[string][]string),
+	}
+
+	codes := []string{sourceLanguage}
+	for _, locale := range config.Locales {
+		if locale.Code != sourceLanguage {
+			codes = append(codes, locale.Code)
+		}
+	}
+	catalogs, err := LoadCatalogs(catalogDir, codes)
+	if err != nil {
+		return report, err
+	}
+
+	hashes, err := LoadSourceHashes(catalogDir, codes[1:])
+	if err != nil {
+		return report, err
+	}
+
+	used, dynamic, err := collectMessageKeys(templateDir)
+	if err != nil {
+		return report, err
+	}
+	report.Locales = codes[1:]
+	report.Dynamic = dynamic
+
+	source := catalogs[sourceLanguage]
+	for key, usages := range used {
+		if source[key] == "" {
+			report.Missing[key] = usages
+		}
+	}
+	for key := range source {
+		if _, ok := used[key]; !ok {
+			report.Unused = append(report.Unused, key)
+		}
+	}
+	sort.Strings(report.Unused)
+
+	for _, lang := range codes[1:] {
+		for key := range source {
+			if catalogs[lang][key] == "" {
+				report.Untranslated[lang] = append(report.Untranslated[lang], key)
+			}
+		}
+		for key := range catalogs[lang] {
+			if _, ok := source[key]; !ok {
+				report.Obsolete[lang] = append(report.Obsolete[lang], key)
+			}
+		}
+		sort.Strings(report.Untranslated[lang])
+		sort.Strings(report.Obsolete[lang])
+		report.Stale[lang] = catalogs.StaleKeys(lang, hashes[lang])
+	}
+	return report, nil
+}
+
+// Print writes the report in a human readable form
+func (r I18nReport) Print() {
+	if len(r.Missing) > 0 {
+		keys := make([]string, 0, len(r.Missing))
+		for key := range r.Missing {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Printf("Missing keys (used but not defined in %s):\n", sourceLanguage)
+		for _, key := range keys {
+			locations := make([]string, len(r.Missing[key]))
+			for i, usage := range r.Missing[key] {
+				locations[i] = usage.Location
+			}
+			fmt.Printf("  %s (%s)\n", key, strings.Join(locations, ", "))
+		}
+	}
+
+	if len(r.Unused) > 0 {
+		fmt.Println("Unused keys (defined but never referenced):")
+		for _, key := range r.Unused {
+			fmt.Printf("  %s\n", key)
+		}
+	}
+
+	for _, lang := range r.Locales {
+		if keys := r.Untranslated[lang]; len(keys) > 0 {
+			fmt.Printf("Untranslated keys in %s (%d):\n", lang, len(keys))
+			for _, key := range keys {
+				fmt.Printf("  %s\n", key)
+			}
+		}
+		if keys := r.Obsolete[lang]; len(keys) > 0 {
+			fmt.Printf("Obsolete keys in %s (%d):\n", lang, len(keys))
+			for _, key := range keys {
+				fmt.Printf("  %s\n", key)
+			}
+		}
+		if keys := r.Stale[lang]; len(keys) > 0 {
+			fmt.Printf("Stale translations in %s (%d), English text changed since translation:\n", lang, len(keys))
+			for _, key := range keys {
+				fmt.Printf("  %s\n", key)
+			}
+		}
+	}
+
+	if len(r.Dynamic) > 0 {
+		fmt.Println("Keys computed at runtime (not checked):")
+		for _, location := range r.Dynamic {
+			fmt.Printf("  %s\n", location)
+		}
+	}
+
+	if r.OK() {
+		fmt.Println("All translations are complete.")
+	}
+}
+
+// checkI18nCommand implements `go run . check-i18n`
+func checkI18nCommand(config Config, args []string) int {
+	report, err := CheckI18n(config, "templates", "locales")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-i18n: %v\n", err)
+		return 2
+	}
+	report.Print()
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// markTranslatedCommand implements `go run . mark-translated <lang> [key...]`.
+// It records the current English text of the given keys, or of every
+// translated key, as the source of their translation into lang.
+func markTranslatedCommand(config Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: mark-translated <lang> [key...]")
+		return 2
+	}
+	lang, keys := args[0], args[1:]
+	known := false
+	for _, locale := range config.Locales {
+		known = known || locale.Code == lang
+	}
+	if !known || lang == sourceLanguage {
+		fmt.Fprintf(os.Stderr, "mark-translated: %q is not a translated locale\n", lang)
+		return 2
+	}
+
+	catalogs, err := LoadCatalogs("locales", []string{sourceLanguage, lang})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mark-translated: %v\n", err)
+		return 2
+	}
+	all, err := LoadSourceHashes("locales", []string{lang})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mark-translated: %v\n", err)
+		return 2
+	}
+	hashes := all[lang]
+
+	if len(keys) == 0 {
+		for key := range catalogs[lang] {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if _, ok := catalogs[lang][key]; !ok {
+			fmt.Fprintf(os.Stderr, "mark-translated: %s has no key %q\n", lang, key)
+			return 2
+		}
+	}
+	catalogs.MarkTranslated(lang, hashes, keys)
+
+	// Forget keys that are gone from the catalog
+	for key := range hashes {
+		if _, ok := catalogs[lang][key]; !ok {
+			delete(hashes, key)
+		}
+	}
+
+	if err := SaveSourceHashes("locales", lang, hashes); err != nil {
+		fmt.Fprintf(os.Stderr, "mark-translated: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Marked %d keys of %s as translated\n", len(keys), lang)
+	return 0
+}
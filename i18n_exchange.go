@@ -0,0 +1,457 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TranslationUnit is one translatable string as handed to translators
+type TranslationUnit struct {
+	Key         string
+	Source      string // English text
+	Translation string // Current translation, empty if there is none
+	Context     string // Templates and pages the key is used on
+	Stale       bool   // Translation was made from an older English text
+}
+
+// exportUnits lists every source key of the site with its translation into lang
+func exportUnits(catalogs Catalogs, hashes SourceHashes, lang string, used map[string][]MessageUsage) []TranslationUnit {
+	stale := make(map[string]bool)
+	for _, key := range catalogs.StaleKeys(lang, hashes) {
+		stale[key] = true
+	}
+
+	units := make([]TranslationUnit, 0, len(catalogs[sourceLanguage]))
+	for key, source := range catalogs[sourceLanguage] {
+		units = append(units, TranslationUnit{
+			Key:         key,
+			Source:      source,
+			Translation: catalogs[lang][key],
+			Context:     usageContext(used[key]),
+			Stale:       stale[key],
+		})
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Key < units[j].Key })
+	return units
+}
+
+// usageContext summarizes where a key is used, one entry per file or page
+func usageContext(usages []MessageUsage) string {
+	var places []string
+	seen := make(map[string]bool)
+	for _, usage := range usages {
+		// Drop the :line:col suffix of template locations
+		place := usage.Location
+		if i := strings.Index(place, ".html:"); i >= 0 {
+			place = place[:i+len(".html")]
+		}
+		if !seen[place] {
+			seen[place] = true
+			places = append(places, place)
+		}
+	}
+	return strings.Join(places, ", ")
+}
+
+// XLIFF 2.0 document, limited to the parts the site uses
+type xliffDocument struct {
+	XMLName xml.Name    `xml:"urn:oasis:names:tc:xliff:document:2.0 xliff"`
+	Version string      `xml:"version,attr"`
+	SrcLang string      `xml:"srcLang,attr"`
+	TrgLang string      `xml:"trgLang,attr"`
+	Files   []xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	ID    string      `xml:"id,attr"`
+	Units []xliffUnit `xml:"unit"`
+}
+
+type xliffUnit struct {
+	ID      string       `xml:"id,attr"`
+	Notes   []xliffNote  `xml:"notes>note,omitempty"`
+	Segment xliffSegment `xml:"segment"`
+}
+
+type xliffNote struct {
+	Category string `xml:"category,attr,omitempty"`
+	Text     string `xml:",chardata"`
+}
+
+type xliffSegment struct {
+	State  string `xml:"state,attr,omitempty"`
+	Source string `xml:"source"`
+	Target string `xml:"target,omitempty"`
+}
+
+// writeXLIFF writes the units as an XLIFF 2.0 document
+func writeXLIFF(w io.Writer, lang string, units []TranslationUnit) error {
+	file := xliffFile{ID: "site"}
+	for _, u := range units {
+		unit := xliffUnit{ID: u.Key, Segment: xliffSegment{Source: u.Source, Target: u.Translation}}
+		if u.Context != "" {
+			unit.Notes = append(unit.Notes, xliffNote{Category: "context", Text: u.Context})
+		}
+		switch {
+		case u.Translation == "":
+			unit.Segment.State = "initial"
+		case u.Stale:
+			unit.Segment.State = "initial"
+			unit.Notes = append(unit.Notes, xliffNote{Category: "stale", Text: "The English text changed after this was translated"})
+		default:
+			unit.Segment.State = "translated"
+		}
+		file.Units = append(file.Units, unit)
+	}
+
+	doc := xliffDocument{Version: "2.0", SrcLang: sourceLanguage, TrgLang: lang, Files: []xliffFile{file}}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// readXLIFF reads the units of an XLIFF 2.0 document translated into lang
+func readXLIFF(r io.Reader, lang string) ([]TranslationUnit, error) {
+	var doc xliffDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.SrcLang != sourceLanguage || doc.TrgLang != lang {
+		return nil, fmt.Errorf("file translates %s to %s, expected %s to %s", doc.SrcLang, doc.TrgLang, sourceLanguage, lang)
+	}
+
+	var units []TranslationUnit
+	for _, file := range doc.Files {
+		for _, unit := range file.Units {
+			units = append(units, TranslationUnit{Key: unit.ID, Source: unit.Segment.Source, Translation: unit.Segment.Target})
+		}
+	}
+	return units, nil
+}
+
+// csvHeader is the first row of exported CSV files
+var csvHeader = []string{"key", "source", "translation", "context"}
+
+// writeCSV writes the units as CSV with a header row
+func writeCSV(w io.Writer, units []TranslationUnit) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, u := range units {
+		if err := writer.Write([]string{u.Key, u.Source, u.Translation, u.Context}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// readCSV reads units from a CSV file written by writeCSV
+func readCSV(r io.Reader) ([]TranslationUnit, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || strings.Join(records[0][:min(len(records[0]), 3)], ",") != "key,source,translation" {
+		return nil, fmt.Errorf("expected a header row starting with key,source,translation")
+	}
+
+	var units []TranslationUnit
+	for _, record := range records[1:] {
+		units = append(units, TranslationUnit{Key: record[0], Source: record[1], Translation: record[2]})
+	}
+	return units, nil
+}
+
+var (
+	placeholderPattern = regexp.MustCompile(`\{[A-Za-z0-9_]+\}`)
+	htmlTagPattern     = regexp.MustCompile(`<(/?)([A-Za-z][A-Za-z0-9]*)[^>]*>`)
+)
+
+// validateTranslation checks that a translation keeps the placeholders and
+// HTML markup of its source text
+func validateTranslation(source, translation string) error {
+	if want, got := placeholders(source), placeholders(translation); want != got {
+		return fmt.Errorf("placeholders %s do not match the source's %s", orNone(got), orNone(want))
+	}
+
+	tags, err := htmlTags(translation)
+	if err != nil {
+		return err
+	}
+	sourceTags, _ := htmlTags(source)
+	if tags != sourceTags {
+		return fmt.Errorf("HTML tags %s do not match the source's %s", orNone(tags), orNone(sourceTags))
+	}
+	return nil
+}
+
+// placeholders returns the sorted {name} placeholders of a message
+func placeholders(message string) string {
+	names := placeholderPattern.FindAllString(message, -1)
+	sort.Strings(names)
+	return strings.Join(names, " ")
+}
+
+// htmlTags returns the sorted tags of an HTML fragment, failing when
+// elements are not properly nested
+func htmlTags(fragment string) (string, error) {
+	var tags, open []string
+	for _, match := range htmlTagPattern.FindAllStringSubmatch(fragment, -1) {
+		closing, name := match[1] == "/", strings.ToLower(match[2])
+		tags = append(tags, match[1]+name)
+		switch {
+		case closing && (len(open) == 0 || open[len(open)-1] != name):
+			return "", fmt.Errorf("unexpected closing tag </%s>", name)
+		case closing:
+			open = open[:len(open)-1]
+		case !isVoidElement(name) && !strings.HasSuffix(match[0], "/>"):
+			open = append(open, name)
+		}
+	}
+	if len(open) > 0 {
+		return "", fmt.Errorf("unclosed tag <%s>", open[len(open)-1])
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, " "), nil
+}
+
+// isVoidElement reports whether an HTML element has no closing tag
+func isVoidElement(name string) bool {
+	switch name {
+	case "br", "hr", "img", "input", "wbr":
+		return true
+	}
+	return false
+}
+
+func orNone(list string) string {
+	if list == "" {
+		return "(none)"
+	}
+	return list
+}
+
+// ImportTranslations validates units translated into lang against the
+// current English text and applies them to the catalog. The source hash of
+// every imported translation is set from the English text in the file, the
+// one it was made from, so translations of text that changed since the
+// export are reported as stale; their keys are returned as well. Nothing is
+// applied if any unit is invalid.
+func ImportTranslations(catalogs Catalogs, hashes SourceHashes, lang string, units []TranslationUnit) (int, []string, []error) {
+	var errs []error
+	var stale []string
+	var accepted []TranslationUnit
+	for _, u := range units {
+		current, ok := catalogs[sourceLanguage][u.Key]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s: unknown key", u.Key))
+			continue
+		case u.Translation == "":
+			continue
+		}
+
+		// The file's source text may have been edited along with the
+		// translation, so placeholders and tags are checked against the
+		// catalog
+		if err := validateTranslation(current, u.Translation); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", u.Key, err))
+			continue
+		}
+		if u.Source == "" {
+			u.Source = current
+		} else if u.Source != current {
+			stale = append(stale, u.Key)
+		}
+		accepted = append(accepted, u)
+	}
+	if len(errs) > 0 {
+		return 0, nil, errs
+	}
+
+	changed := 0
+	for _, u := range accepted {
+		if catalogs[lang][u.Key] != u.Translation || hashes[u.Key] != sourceHash(u.Source) {
+			changed++
+		}
+		catalogs[lang][u.Key] = u.Translation
+		hashes[u.Key] = sourceHash(u.Source)
+	}
+	return changed, stale, nil
+}
+
+// loadTranslationState loads the catalogs, source hashes and key usages
+// needed to exchange the translations of lang
+func loadTranslationState(config Config, lang string) (Catalogs, SourceHashes, map[string][]MessageUsage, error) {
+	known := false
+	for _, locale := range config.Locales {
+		known = known || locale.Code == lang
+	}
+	if !known || lang == sourceLanguage {
+		return nil, nil, nil, fmt.Errorf("%q is not a translated locale", lang)
+	}
+
+	catalogs, err := LoadCatalogs("locales", []string{sourceLanguage, lang})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hashes, err := LoadSourceHashes("locales", []string{lang})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	used, _, err := collectMessageKeys("templates")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return catalogs, hashes[lang], used, nil
+}
+
+// exchangeFormat picks the file format from the --format flag or the file
+// extension
+func exchangeFormat(format, path string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(path), ".")
+		if format == "xlf" {
+			format = "xliff"
+		}
+	}
+	if format != "xliff" && format != "csv" {
+		return "", fmt.Errorf("unknown format %q, use xliff or csv", format)
+	}
+	return format, nil
+}
+
+// exportI18nCommand implements
+// `go run . export-i18n --lang ru [--format xliff|csv] [--output file]`
+func exportI18nCommand(config Config, args []string) int {
+	flags := flag.NewFlagSet("export-i18n", flag.ExitOnError)
+	lang := flags.String("lang", "", "Locale to export")
+	format := flags.String("format", "", "xliff or csv, taken from the --output extension when omitted")
+	output := flags.String("output", "", "File to write, standard output when omitted")
+	flags.Parse(args)
+
+	if *format == "" && *output == "" {
+		*format = "xliff"
+	}
+	kind, err := exchangeFormat(*format, *output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export-i18n: %v\n", err)
+		return 2
+	}
+	catalogs, hashes, used, err := loadTranslationState(config, *lang)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export-i18n: %v\n", err)
+		return 2
+	}
+	units := exportUnits(catalogs, hashes, *lang, used)
+
+	w := os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export-i18n: %v\n", err)
+			return 2
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if kind == "csv" {
+		err = writeCSV(w, units)
+	} else {
+		err = writeXLIFF(w, *lang, units)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export-i18n: %v\n", err)
+		return 2
+	}
+	if *output != "" {
+		fmt.Printf("Exported %d strings for %s to %s\n", len(units), *lang, *output)
+	}
+	return 0
+}
+
+// importI18nCommand implements `go run . import-i18n --lang ru <file>`
+func importI18nCommand(config Config, args []string) int {
+	flags := flag.NewFlagSet("import-i18n", flag.ExitOnError)
+	lang := flags.String("lang", "", "Locale the file translates into")
+	format := flags.String("format", "", "xliff or csv, taken from the file extension when omitted")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: import-i18n --lang <lang> [--format xliff|csv] <file>")
+		return 2
+	}
+	path := flags.Arg(0)
+
+	kind, err := exchangeFormat(*format, path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import-i18n: %v\n", err)
+		return 2
+	}
+	catalogs, hashes, _, err := loadTranslationState(config, *lang)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import-i18n: %v\n", err)
+		return 2
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import-i18n: %v\n", err)
+		return 2
+	}
+	defer file.Close()
+
+	var units []TranslationUnit
+	if kind == "csv" {
+		units, err = readCSV(file)
+	} else {
+		units, err = readXLIFF(file, *lang)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import-i18n: %s: %v\n", path, err)
+		return 2
+	}
+
+	changed, stale, errs := ImportTranslations(catalogs, hashes, *lang, units)
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "import-i18n: %s was not imported:\n", path)
+		for _, err := range errs {
+			fmt.Fprintf(os.Stderr, "  %v\n", err)
+		}
+		return 1
+	}
+
+	if err := writeJSON(filepath.Join("locales", *lang+".json"), catalogs[*lang]); err != nil {
+		fmt.Fprintf(os.Stderr, "import-i18n: %v\n", err)
+		return 2
+	}
+	if err := SaveSourceHashes("locales", *lang, hashes); err != nil {
+		fmt.Fprintf(os.Stderr, "import-i18n: %v\n", err)
+		return 2
+	}
+	fmt.Printf("Imported %d changed translations into locales/%s.json\n", changed, *lang)
+	if len(stale) > 0 {
+		fmt.Printf("The English text of %d keys changed since the export, their translations stay marked as outdated:\n", len(stale))
+		for _, key := range stale {
+			fmt.Printf("  %s\n", key)
+		}
+	}
+	return 0
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"time"
+	"os"
+	"path"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -15,48 +19,104 @@ import (
 type PageData struct {
 	Title   string
 	Lang    string
+	Locale  Locale
+	Locales []Locale
+	Path    string
 	Year    int
 	BaseURL string
-}
 
-// Load all templates at startup instead of on each request
-var templates map[string]*template.Template
+	// Set on pages written in Markdown
+	Description string
+	Front       FrontMatter
+	Content     template.HTML
+	Docs        *DocNav // Navigation of documentation pages
+
+	API *APIView // Set on pages of the API reference
 
-func loadTemplates() {
-	templates = make(map[string]*template.Template)
+	Versions *VersionNav // Set on pages kept per release of a module
 
-	// Define base templates that should be included in every page
-	baseTemplates := []string{"templates/layout.html", "templates/translations.html"}
+	// Translations of this page's language that are out of date, only
+	// filled in on a development server
+	StaleTranslations []string
 
-	// Load page templates
-	templates["home"] = template.Must(template.ParseFiles(append(baseTemplates, "templates/home.html")...))
-	templates["features"] = template.Must(template.ParseFiles(append(baseTemplates, "templates/features.html")...))
-	templates["examples"] = template.Must(template.ParseFiles(append(baseTemplates, "templates/examples.html")...))
-	templates["mr-graphics"] = template.Must(template.ParseFiles(append(baseTemplates, "templates/subprojects/mr-graphics.html")...))
-	templates["mr-importer"] = template.Must(template.ParseFiles(append(baseTemplates, "templates/subprojects/mr-importer.html")...))
-	templates["mr-contractor"] = template.Must(template.ParseFiles(append(baseTemplates, "templates/subprojects/mr-contractor.html")...))
-	templates["mr-math"] = template.Must(template.ParseFiles(append(baseTemplates, "templates/subprojects/mr-math.html")...))
+	site *Site
+	deps *Dependencies // Inputs of the page, recorded by Snippet
 }
 
 func main() {
 	// Parse command line flags
+	configPath := flag.String("config", "config.json", "Path to the site configuration file")
 	githubPages := flag.Bool("github-pages", false, "Generate GitHub Pages static site")
+	preview := flag.Bool("preview", false, "Serve the generated static site under the base path")
+	output := flag.String("output", "docs", "Output directory for --github-pages and --preview")
+	report := flag.String("report", "", "Write a JSON report of the --github-pages build to this file")
+	jobs := flag.Int("jobs", 0, "Pages --github-pages renders at the same time (default: number of CPUs)")
+	force := flag.Bool("force", false, "Render every page with --github-pages instead of reusing unchanged ones")
+	verifyReproducible := flag.Bool("verify-reproducible", false, "Build the static site twice and fail if the outputs differ, leaving --output alone")
+	basePath := flag.String("base-path", "", "URL prefix the site is served under (overrides the config file)")
 	port := flag.String("port", "4747", "Port to run the server on")
+	dev := flag.Bool("dev", false, "Show development aids such as a banner listing stale translations")
+	pseudo := flag.Bool("pseudo", false, "Add the pseudo-locale \""+pseudoLanguage+"\" for layout testing")
 	flag.Parse()
 
-	// Load all templates
-	loadTemplates()
+	config, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *basePath != "" {
+		config.BasePath = normalizeBasePath(*basePath)
+	}
+
+	// Subcommands such as check-i18n run instead of the server
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(config, flag.Arg(0), flag.Args()[1:]))
+	}
+
+	if *pseudo {
+		config.Locales = append(config.Locales, pseudoLocale)
+	}
+
+	if *verifyReproducible {
+		if err := VerifyReproducible(config, *jobs); err != nil {
+			log.Fatalf("Build is not reproducible: %v", err)
+		}
+		return
+	}
 
 	// If --github-pages flag is set, generate GitHub Pages site and exit
 	if *githubPages {
-		GenerateGitHubPages()
+		if err := GenerateGitHubPages(config, BuildOptions{OutputDir: *output, ReportPath: *report, Jobs: *jobs, Force: *force}); err != nil {
+			log.Fatalf("Static site generation failed: %v", err)
+		}
 		return
 	}
 
+	site, err := NewSite(config, false)
+	if err != nil {
+		log.Fatalf("Failed to load site: %v", err)
+	}
+	site.Dev = *dev
+	handler := newRouter(site)
+	if *preview {
+		handler = newPreviewHandler(config, *output)
+	}
+
+	// Start server
+	log.Printf("Server starting on :%s - Visit http://localhost:%s%s\n", *port, *port, config.BasePath)
+	log.Printf("To generate GitHub Pages site, restart with: go run . --github-pages\n")
+	if err := http.ListenAndServe(":"+*port, middleware.Logger(handler)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// newRouter builds the router serving the whole site. It is shared by the
+// live server and the GitHub Pages generator, which crawls it in-process.
+// Pages are served at locale-prefixed paths (/ru/features/) in both modes;
+// only the legacy URLs differ.
+func newRouter(site *Site) chi.Router {
 	r := chi.NewRouter()
 
 	// Middleware
-	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
@@ -69,106 +129,226 @@ func main() {
 
 	// Serve static files
 	fileServer := http.FileServer(http.Dir("assets"))
-	r.Handle("/assets/*", http.StripPrefix("/assets/", fileServer))
+	r.Handle("/assets/*", http.StripPrefix(site.URL("/assets/", ""), fileServer))
 
 	// Routes
-	r.Get("/", handleHome)
-	r.Get("/features", handleFeatures)
-	r.Get("/examples", handleExamples)
-	r.Get("/docs", handleDocs)
-	r.Get("/download", handleDownload)
-
-	// Subproject routes
-	r.Get("/subprojects/mr-graphics", handleMRGraphics)
-	r.Get("/subprojects/mr-importer", handleMRImporter)
-	r.Get("/subprojects/mr-contractor", handleMRContractor)
-	r.Get("/subprojects/mr-math", handleMRMath)
+	for _, p := range site.Pages {
+		for _, locale := range site.Locales {
+			r.Get(site.route(p.Path, locale.Code), site.handlePage(p, locale.Code))
+		}
+	}
 
-	// Start server
-	log.Printf("Server starting on :%s - Visit http://localhost:%s\n", *port, *port)
-	log.Printf("To generate GitHub Pages site, restart with: go run . --github-pages\n")
-	if err := http.ListenAndServe(":"+*port, r); err != nil {
-		log.Fatal(err)
+	// The release manifest for scripts, next to the download page
+	r.Get("/download/releases.json", site.handleReleases)
+
+	// Styles of the code highlighted on the server
+	r.Get(highlightCSSRoute, site.handleHighlightCSS)
+
+	// Keep links to the old URL schemes working: /features?lang=ru on the
+	// server and /features/index_ru.html on GitHub Pages. Guides and older
+	// versions of module pages came after and have no old URLs.
+	for _, p := range pages {
+		if p.Version != "" && path.Base(p.Path) == p.Version {
+			continue
+		}
+		if !site.Static {
+			// The home page has the same route, handlePage tells old links
+			// from language choices
+			if p.Path != "/" {
+				r.Get(p.Path, site.handleLegacy(p, ""))
+			}
+			continue
+		}
+		for _, lang := range legacyLanguages {
+			if _, ok := site.Locale(lang); !ok || lang == site.DefaultLang() {
+				continue
+			}
+			r.Get(site.legacyFile(p, lang), site.handleLegacy(p, lang))
+		}
 	}
+
+	return mountBasePath(site.BasePath, r)
 }
 
-func getLanguage(r *http.Request) string {
-	lang := r.URL.Query().Get("lang")
-	if lang == "ru" {
-		return "ru"
+// runCommand runs the named subcommand and returns its exit code
+func runCommand(config Config, name string, args []string) int {
+	switch name {
+	case "check-i18n":
+		return checkI18nCommand(config, args)
+	case "check-symbols":
+		return checkSymbolsCommand(config, args)
+	case "mark-translated":
+		return markTranslatedCommand(config, args)
+	case "export-i18n":
+		return exportI18nCommand(config, args)
+	case "import-i18n":
+		return importI18nCommand(config, args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q (available: check-i18n, check-symbols, mark-translated, export-i18n, import-i18n)\n", name)
+		return 2
 	}
-	return "en" // Default to English
 }
 
-func getPageData(title string, r *http.Request) PageData {
-	return PageData{
-		Title: title,
-		Lang:  getLanguage(r),
-		Year:  time.Now().Year(),
-	}
+// newPreviewHandler serves a generated static site the way GitHub Pages
+// would, under the configured base path
+func newPreviewHandler(config Config, outputDir string) chi.Router {
+	fileServer := http.FileServer(http.Dir(outputDir))
+	return mountBasePath(config.BasePath, http.StripPrefix(strings.TrimSuffix(config.BasePath, "/"), fileServer))
 }
 
-func renderTemplate(w http.ResponseWriter, tmpl string, data PageData) {
-	if t, ok := templates[tmpl]; ok {
-		err := t.ExecuteTemplate(w, "layout", data)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			log.Printf("Error rendering template: %v", err)
-		}
-	} else {
-		http.Error(w, "Template not found", http.StatusInternalServerError)
+// mountBasePath serves the handler under the base path and redirects the
+// bare root to it
+func mountBasePath(basePath string, handler http.Handler) chi.Router {
+	r := chi.NewRouter()
+	if basePath == "/" {
+		r.Mount("/", handler)
+		return r
 	}
-}
 
-func handleHome(w http.ResponseWriter, r *http.Request) {
-	data := getPageData("Game Engine", r)
-	renderTemplate(w, "home", data)
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, basePath, http.StatusTemporaryRedirect)
+	})
+	r.Mount(strings.TrimSuffix(basePath, "/"), handler)
+	return r
 }
 
-func handleFeatures(w http.ResponseWriter, r *http.Request) {
-	data := getPageData("Features - Game Engine", r)
-	renderTemplate(w, "features", data)
-}
+// langCookie remembers the language a visitor picked
+const langCookie = "lang"
 
-func handleExamples(w http.ResponseWriter, r *http.Request) {
-	data := getPageData("Examples - Game Engine", r)
-	renderTemplate(w, "examples", data)
-}
+// preferredLanguage returns the language a visitor prefers: the choice
+// remembered from the language picker, then the browser's Accept-Language
+// header, then the default language
+func (s *Site) preferredLanguage(r *http.Request) string {
+	if cookie, err := r.Cookie(langCookie); err == nil {
+		if _, ok := s.Locale(cookie.Value); ok {
+			return cookie.Value
+		}
+	}
 
-func handleDocs(w http.ResponseWriter, r *http.Request) {
-	// Preserve language parameter when redirecting to home
-	redirectURL := "/"
-	if lang := r.URL.Query().Get("lang"); lang == "ru" {
-		redirectURL = "/?lang=ru"
+	codes := make([]string, len(s.Locales))
+	for i, locale := range s.Locales {
+		codes[i] = locale.Code
+	}
+	if lang, ok := negotiateLanguage(r.Header.Get("Accept-Language"), codes); ok {
+		return lang
 	}
-	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+	return s.DefaultLang()
 }
 
-func handleDownload(w http.ResponseWriter, r *http.Request) {
-	// Preserve language parameter when redirecting to home
-	redirectURL := "/"
-	if lang := r.URL.Query().Get("lang"); lang == "ru" {
-		redirectURL = "/?lang=ru"
+// getPageData collects what the templates of a page show, recording the
+// inputs it reads in deps unless that is nil
+func (s *Site) getPageData(p Page, lang string, deps *Dependencies) PageData {
+	deps.message(p.Title)
+	locale, _ := s.Locale(lang)
+	data := PageData{
+		Title:   string(s.Catalogs.Translate(lang, p.Title)),
+		Lang:    lang,
+		Locale:  locale,
+		Locales: s.Locales,
+		Path:    p.Path,
+		Year:    s.clock.Year(),
+		BaseURL: s.BasePath,
+		site:    s,
+		deps:    deps,
 	}
-	http.Redirect(w, r, redirectURL, http.StatusTemporaryRedirect)
+	if front, ok := s.markdown[p.Name][lang]; ok {
+		data.Title = string(s.Catalogs.Translate(lang, markdownTitleKey, "title", front.Title))
+		data.Description = front.Description
+		data.Front = front.FrontMatter
+		data.Content = s.content[p.Name][lang]
+		data.Docs = s.docNav(p, lang)
+		deps.message(markdownTitleKey)
+		deps.file(s.inputs[p.Name][lang]...)
+		if data.Docs != nil {
+			// The sidebar shows the titles of every guide
+			deps.file(docsDir)
+		}
+	}
+	data.Versions = s.pageVersions(p, lang)
+	if view := s.apiView(p, lang); view != nil {
+		data.Title = string(s.Catalogs.Translate(lang, markdownTitleKey, "title", view.Title))
+		data.API = view
+		deps.message(markdownTitleKey)
+		deps.message(apiMessageKeys()...)
+	}
+	if s.Dev {
+		data.StaleTranslations = s.stale[lang]
+	}
+	return data
 }
 
-func handleMRGraphics(w http.ResponseWriter, r *http.Request) {
-	data := getPageData("MR Graphics - Game Engine", r)
-	renderTemplate(w, "mr-graphics", data)
-}
+// handlePage serves a page from the page table in the given language
+func (s *Site) handlePage(p Page, lang string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.Static {
+			// The language picker links to the page in the chosen language
+			// with ?lang=, which is remembered. Another language in ?lang=
+			// is an old link, such as /?lang=ru from before languages moved
+			// into path prefixes.
+			choice := r.URL.Query().Get("lang")
+			if choice != "" && choice != lang {
+				s.handleLegacy(p, "")(w, r)
+				return
+			}
+			if choice != "" {
+				if _, ok := s.Locale(choice); ok {
+					http.SetCookie(w, &http.Cookie{
+						Name:     langCookie,
+						Value:    choice,
+						Path:     s.BasePath,
+						MaxAge:   365 * 24 * 60 * 60,
+						SameSite: http.SameSiteLaxMode,
+					})
+					http.Redirect(w, r, s.URL(p.Path, choice), http.StatusFound)
+					return
+				}
+			}
+
+			// Unprefixed pages send visitors who prefer another language there.
+			// The response depends on the visitor's headers, tell caches so.
+			if lang == s.DefaultLang() {
+				w.Header().Add("Vary", "Accept-Language, Cookie")
+				if preferred := s.preferredLanguage(r); preferred != lang {
+					http.Redirect(w, r, s.URL(p.Path, preferred), http.StatusFound)
+					return
+				}
+			}
+		}
+		w.Header().Set("Content-Language", lang)
 
-func handleMRImporter(w http.ResponseWriter, r *http.Request) {
-	data := getPageData("MR Importer - Game Engine", r)
-	renderTemplate(w, "mr-importer", data)
+		// Pages without content send the visitor to their redirect target
+		if p.Redirect != "" {
+			http.Redirect(w, r, s.URL(p.Redirect, lang), http.StatusTemporaryRedirect)
+			return
+		}
+		rec := requestRecorder(r)
+		s.renderTemplate(w, p, s.getPageData(p, lang, rec.current()), rec)
+	}
 }
 
-func handleMRContractor(w http.ResponseWriter, r *http.Request) {
-	data := getPageData("MR Contractor - Game Engine", r)
-	renderTemplate(w, "mr-contractor", data)
+// handleReleases serves the release manifest as JSON
+func (s *Site) handleReleases(w http.ResponseWriter, r *http.Request) {
+	requestRecorder(r).current().file(releasesFile)
+	data, err := json.MarshalIndent(s.Releases, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
 }
 
-func handleMRMath(w http.ResponseWriter, r *http.Request) {
-	data := getPageData("MR Math - Game Engine", r)
-	renderTemplate(w, "mr-math", data)
+// handleLegacy permanently redirects an old URL of a page to its current
+// one. An empty lang takes the language from the ?lang= parameter.
+func (s *Site) handleLegacy(p Page, lang string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := lang
+		if target == "" {
+			target = s.DefaultLang()
+			if _, ok := s.Locale(r.URL.Query().Get("lang")); ok {
+				target = r.URL.Query().Get("lang")
+			}
+		}
+		http.Redirect(w, r, s.URL(p.Path, target), http.StatusMovedPermanently)
+	}
 }
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultMarkdownTemplate renders Markdown pages whose front matter does not
+// name a template
+const defaultMarkdownTemplate = "markdown.html"
+
+// markdownTitleKey is the message that turns the front matter title into
+// the document title, e.g. "{title} - model-renderer"
+const markdownTitleKey = "title.page"
+
+// FrontMatter is the YAML block at the top of a Markdown page
+type FrontMatter struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Language    string `yaml:"language"` // Defaults to the language in the file name
+	Order       int    `yaml:"order"`    // Position among sibling pages
+	Template    string `yaml:"template"` // Content template in templates/, e.g. "module.html"
+	GitHub      string `yaml:"github"`   // Repository linked from module pages
+}
+
+// MarkdownPage is one language version of a page written in Markdown
+type MarkdownPage struct {
+	FrontMatter
+	Path string // Source file
+	Body []byte // Markdown after the front matter
+	Line int    // Line of the file the body starts on, for error messages
+}
+
+// ParseMarkdownPage reads a Markdown file with optional front matter. The
+// language is taken from the file name (mr-math.ru.md) unless the front
+// matter sets it; a file without either is in the source language.
+func ParseMarkdownPage(path string) (MarkdownPage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return MarkdownPage{}, err
+	}
+	// Files saved on Windows have CRLF line endings, which neither the front
+	// matter nor the snippet shortcodes would match
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	page := MarkdownPage{Path: path, Body: data, Line: 1}
+
+	// Front matter is delimited by --- lines at the very start of the file,
+	// and may be empty
+	if rest, ok := bytes.CutPrefix(data, []byte("---\n")); ok {
+		front, body, found := bytes.Cut(rest, []byte("\n---\n"))
+		if empty, ok := bytes.CutPrefix(rest, []byte("---\n")); ok {
+			front, body, found = nil, empty, true
+		}
+		if !found {
+			return page, fmt.Errorf("%s: front matter is not closed with ---", path)
+		}
+		if err := yaml.Unmarshal(front, &page.FrontMatter); err != nil {
+			return page, fmt.Errorf("%s: invalid front matter: %v", path, err)
+		}
+		page.Body = body
+		page.Line = bytes.Count(data[:len(data)-len(body)], []byte("\n")) + 1
+	}
+
+	fileLang := markdownLanguage(path)
+	switch {
+	case page.Language == "" && fileLang == "":
+		page.Language = sourceLanguage
+	case page.Language == "":
+		page.Language = fileLang
+	case fileLang != "" && page.Language != fileLang:
+		return page, fmt.Errorf("%s: front matter language %q does not match the file name", path, page.Language)
+	}
+	return page, nil
+}
+
+// markdownLanguage returns the language suffix of a file name such as
+// mr-math.ru.md, or "" if there is none
+func markdownLanguage(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".md")
+	if ext := filepath.Ext(name); ext != "" {
+		return ext[1:]
+	}
+	return ""
+}
+
+// LoadMarkdownPages reads every language version of a Markdown page. base is
+// the path without language and extension, e.g. "content/subprojects/mr-math"
+// for mr-math.en.md, mr-math.ru.md and so on. The source language version is
+// required because other languages fall back to it.
+func LoadMarkdownPages(base string) (map[string]MarkdownPage, error) {
+	files, err := filepath.Glob(base + ".*.md")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(base + ".md"); err == nil {
+		files = append(files, base+".md")
+	}
+
+	versions := make(map[string]MarkdownPage)
+	for _, file := range files {
+		page, err := ParseMarkdownPage(file)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := versions[page.Language]; ok {
+			return nil, fmt.Errorf("%s and %s are both in %q", other.Path, file, page.Language)
+		}
+		versions[page.Language] = page
+	}
+	if _, ok := versions[sourceLanguage]; !ok {
+		return nil, fmt.Errorf("%s: no %s version found", base, sourceLanguage)
+	}
+	return versions, nil
+}
+
+// markdown converts page bodies to HTML. Raw HTML is allowed since pages are
+// written by the team, headings get ids so they can be linked to, and code
+// is highlighted by codeRenderer.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	goldmark.WithRendererOptions(
+		html.WithUnsafe(),
+		renderer.WithNodeRenderers(util.Prioritized(codeRenderer{}, 100)),
+	),
+)
+
+// renderMarkdown converts Markdown to HTML, passing the destination of every
+// link and image through link and linking C++ names in code with
+// linkSymbol. It also returns the second and third level headings for a
+// table of contents.
+func renderMarkdown(source []byte, link, linkSymbol func(string) string) (template.HTML, []TOCEntry, error) {
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{seen: make(map[string]bool)}))
+	doc := markdown.Parser().Parse(text.NewReader(source), parser.WithContext(ctx))
+	doc.OwnerDocument().AddMeta(codeLinksMeta, linkSymbol)
+	var toc []TOCEntry
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			if id, ok := n.AttributeString("id"); ok && (n.Level == 2 || n.Level == 3) {
+				toc = append(toc, TOCEntry{Level: n.Level, ID: string(id.([]byte)), Title: string(n.Text(source))})
+			}
+		case *ast.Link:
+			n.Destination = []byte(link(string(n.Destination)))
+		case *ast.Image:
+			n.Destination = []byte(link(string(n.Destination)))
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, source, doc); err != nil {
+		return "", nil, err
+	}
+	return template.HTML(buf.String()), toc, nil
+}
+
+// headingIDs generates heading anchors from the heading text. Unlike the
+// goldmark default it keeps non-Latin letters, so Russian headings get
+// readable anchors too.
+type headingIDs struct {
+	seen map[string]bool
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	id := strings.TrimSuffix(b.String(), "-")
+	if id == "" {
+		id = "section"
+	}
+
+	unique := id
+	for i := 1; ids.seen[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+	ids.seen[unique] = true
+	return []byte(unique)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.seen[string(value)] = true
+}
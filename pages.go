@@ -0,0 +1,85 @@
+package main
+
+// Page describes a single page of the site. This table is the only place
+// pages are declared, apart from the documentation guides found in
+// content/docs: it drives template loading, router registration, directory
+// creation and the GitHub Pages generator.
+type Page struct {
+	Name     string // Key of the page in the templates map
+	Path     string // Route on the live server
+	Template string // Content template, empty for redirects and Markdown pages
+	Content  string // Markdown source without language and extension, e.g. "content/about" for about.en.md
+	Title    string // Message key of the page title, Markdown pages take it from the front matter
+	Output   string // Output directory relative to the site root of each language
+	Redirect string // If set, the page redirects to this route instead of rendering
+	Version  string // Release of the module a versioned page describes, see versions.go
+}
+
+// pages lists every page served by the site
+var pages = []Page{
+	{
+		Name:     "home",
+		Path:     "/",
+		Template: "templates/home.html",
+		Title:    "title.home",
+		Output:   "",
+	},
+	{
+		Name:     "features",
+		Path:     "/features",
+		Template: "templates/features.html",
+		Title:    "title.features",
+		Output:   "features",
+	},
+	{
+		Name:     "examples",
+		Path:     "/examples",
+		Template: "templates/examples.html",
+		Title:    "title.examples",
+		Output:   "examples",
+	},
+	{
+		// Guides below /docs/ are added from content/docs, see docs.go
+		Name:    "docs",
+		Path:    "/docs",
+		Content: "content/docs/index",
+		Output:  "docs",
+	},
+	{
+		Name:     "download",
+		Path:     "/download",
+		Template: "templates/download.html",
+		Title:    "title.download",
+		Output:   "download",
+	},
+
+	// Subproject pages
+	{
+		Name:     "mr-graphics",
+		Path:     "/subprojects/mr-graphics",
+		Template: "templates/subprojects/mr-graphics.html",
+		Title:    "title.mr_graphics",
+		Output:   "subprojects/mr-graphics",
+		Version:  "v0.3",
+	},
+	{
+		Name:     "mr-importer",
+		Path:     "/subprojects/mr-importer",
+		Template: "templates/subprojects/mr-importer.html",
+		Title:    "title.mr_importer",
+		Output:   "subprojects/mr-importer",
+	},
+	{
+		Name:     "mr-contractor",
+		Path:     "/subprojects/mr-contractor",
+		Template: "templates/subprojects/mr-contractor.html",
+		Title:    "title.mr_contractor",
+		Output:   "subprojects/mr-contractor",
+	},
+	{
+		Name:    "mr-math",
+		Path:    "/subprojects/mr-math",
+		Content: "content/subprojects/mr-math",
+		Output:  "subprojects/mr-math",
+	},
+}
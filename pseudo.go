@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// pseudoLanguage is the code of the built-in pseudo-locale. Its messages are
+// generated from the source language so that layout problems and text that
+// bypasses the catalogs stand out without waiting for real translations.
+const pseudoLanguage = "xx"
+
+// pseudoLocale is added to the configured locales by --pseudo
+var pseudoLocale = Locale{Code: pseudoLanguage, Name: "Pseudo", Flag: "🔤"}
+
+// pseudoExpansion is how much longer pseudo messages are than the source,
+// roughly the growth of Russian text over English
+const pseudoExpansion = 0.4
+
+// pseudoLetters maps ASCII letters to accented look-alikes
+var pseudoLetters = map[rune]rune{
+	'a': 'à', 'b': 'ƀ', 'c': 'ç', 'd': 'ð', 'e': 'é', 'f': 'ƒ', 'g': 'ĝ',
+	'h': 'ĥ', 'i': 'î', 'j': 'ĵ', 'k': 'ķ', 'l': 'ļ', 'm': 'ɱ', 'n': 'ñ',
+	'o': 'ö', 'p': 'þ', 'q': 'ǫ', 'r': 'ŕ', 's': 'š', 't': 'ţ', 'u': 'û',
+	'v': 'ṽ', 'w': 'ŵ', 'x': 'ẋ', 'y': 'ý', 'z': 'ž',
+	'A': 'Å', 'B': 'Ɓ', 'C': 'Ç', 'D': 'Ð', 'E': 'É', 'F': 'Ƒ', 'G': 'Ĝ',
+	'H': 'Ĥ', 'I': 'Î', 'J': 'Ĵ', 'K': 'Ķ', 'L': 'Ļ', 'M': 'Ṁ', 'N': 'Ñ',
+	'O': 'Ö', 'P': 'Þ', 'Q': 'Ǫ', 'R': 'Ŕ', 'S': 'Š', 'T': 'Ţ', 'U': 'Û',
+	'V': 'Ṽ', 'W': 'Ŵ', 'X': 'Ẋ', 'Y': 'Ý', 'Z': 'Ž',
+}
+
+// pseudoLocalize turns a message into its pseudo-locale form, e.g.
+// "Get Started" becomes "[Ĝéţ Šţàŕţéð ····]". Placeholders, HTML tags and
+// entities are kept as they are so the message still renders.
+func pseudoLocalize(message string) string {
+	var b strings.Builder
+	b.WriteString("[")
+
+	letters := 0
+	for i := 0; i < len(message); {
+		// Copy {name}, <tag> and &entity; unchanged
+		if end := pseudoVerbatimEnd(message[i:]); end > 0 {
+			b.WriteString(message[i : i+end])
+			i += end
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(message[i:])
+		if accented, ok := pseudoLetters[r]; ok {
+			r = accented
+		}
+		if r != ' ' {
+			letters++
+		}
+		b.WriteRune(r)
+		i += size
+	}
+
+	if padding := int(float64(letters)*pseudoExpansion + 0.5); padding > 0 {
+		b.WriteString(" ")
+		b.WriteString(strings.Repeat("·", padding))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// pseudoVerbatimEnd returns the length of the placeholder, tag or entity s
+// starts with, or 0
+func pseudoVerbatimEnd(s string) int {
+	var closer string
+	switch s[0] {
+	case '{':
+		closer = "}"
+	case '<':
+		closer = ">"
+	case '&':
+		closer = ";"
+	default:
+		return 0
+	}
+
+	end := strings.Index(s, closer)
+	if end < 0 {
+		return 0
+	}
+	// A lone & or { in prose is text, not an entity or placeholder
+	if s[0] != '<' && strings.ContainsAny(s[1:end], " \n") {
+		return 0
+	}
+	return end + 1
+}
+
+// AddPseudo generates the pseudo-locale catalog from the source language
+func (c Catalogs) AddPseudo() {
+	pseudo := make(Catalog, len(c[sourceLanguage]))
+	for key, message := range c[sourceLanguage] {
+		pseudo[key] = pseudoLocalize(message)
+	}
+	c[pseudoLanguage] = pseudo
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releasesFile is the release manifest of the site
+const releasesFile = "releases.json"
+
+// ReleaseManifest lists the published builds of the engine modules. It is
+// read from releases.json and rendered on the download page; scripts can
+// fetch the same data from /download/releases.json.
+type ReleaseManifest struct {
+	Releases []Release `json:"releases"`
+}
+
+// Release is one version of a module
+type Release struct {
+	Module    string     `json:"module"`
+	Version   string     `json:"version"`         // e.g. "0.3.0"
+	Date      string     `json:"date"`            // Release date as YYYY-MM-DD
+	Notes     string     `json:"notes,omitempty"` // Short summary of the changes
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Artifact is a downloadable build of a release for one platform
+type Artifact struct {
+	Platform string `json:"platform"` // e.g. "windows-x64", "linux-x64", "source"
+	URL      string `json:"url"`
+	Size     int64  `json:"size,omitempty"`   // In bytes
+	SHA256   string `json:"sha256,omitempty"` // Hex encoded checksum
+}
+
+// modulePath returns the route of the page of a module
+func modulePath(module string) string {
+	return "/subprojects/" + module
+}
+
+// ModuleReleases groups the releases of one module, newest first
+type ModuleReleases struct {
+	Module   string
+	Latest   Release
+	Previous []Release
+}
+
+// LoadReleases reads the release manifest. A missing file means nothing has
+// been released yet, which the development server shows but the static
+// site generator refuses to publish.
+func LoadReleases(path string) (ReleaseManifest, error) {
+	manifest := ReleaseManifest{Releases: []Release{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	if err := manifest.validate(); err != nil {
+		return manifest, fmt.Errorf("error in %s: %v", path, err)
+	}
+	return manifest, nil
+}
+
+// validate checks that every release can be shown and verified
+func (m ReleaseManifest) validate() error {
+	seen := make(map[string]bool)
+	for _, r := range m.Releases {
+		if r.Module == "" || r.Version == "" {
+			return fmt.Errorf("release without module or version")
+		}
+		id := r.Module + " " + r.Version
+		if seen[id] {
+			return fmt.Errorf("%s is listed twice", id)
+		}
+		seen[id] = true
+
+		if _, err := time.Parse(time.DateOnly, r.Date); err != nil {
+			return fmt.Errorf("%s: date %q is not YYYY-MM-DD", id, r.Date)
+		}
+		if len(r.Artifacts) == 0 {
+			return fmt.Errorf("%s: no artifacts", id)
+		}
+		for _, a := range r.Artifacts {
+			if a.Platform == "" || a.URL == "" {
+				return fmt.Errorf("%s: artifact without platform or url", id)
+			}
+			if sum, err := hex.DecodeString(a.SHA256); a.SHA256 != "" && (err != nil || len(sum) != 32) {
+				return fmt.Errorf("%s %s: sha256 is not a hex encoded SHA-256", id, a.Platform)
+			}
+		}
+	}
+	return nil
+}
+
+// ByModule groups the releases per module in the order the modules first
+// appear in the manifest, with the highest version of each as the latest
+func (m ReleaseManifest) ByModule() []ModuleReleases {
+	var modules []string
+	releases := make(map[string][]Release)
+	for _, r := range m.Releases {
+		if _, ok := releases[r.Module]; !ok {
+			modules = append(modules, r.Module)
+		}
+		releases[r.Module] = append(releases[r.Module], r)
+	}
+
+	groups := make([]ModuleReleases, len(modules))
+	for i, module := range modules {
+		list := releases[module]
+		sort.SliceStable(list, func(a, b int) bool {
+			return compareVersions(list[a].Version, list[b].Version) > 0
+		})
+		groups[i] = ModuleReleases{Module: module, Latest: list[0], Previous: list[1:]}
+	}
+	return groups
+}
+
+// compareVersions orders versions such as "0.3.0", "v0.10" and "1.0.0-rc1"
+// numerically and returns -1, 0 or 1. Pre-releases sort before the release.
+func compareVersions(a, b string) int {
+	a, aPre, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	b, bPre, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	default:
+		return strings.Compare(aPre, bPre)
+	}
+}
+
+// formatSize returns a size in bytes in a human readable form
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, suffix := float64(size)/unit, 0
+	for value >= unit && suffix < 3 {
+		value /= unit
+		suffix++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[suffix])
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Site renders the pages of the site. Every language but the default one
+// lives under its own prefix (/ru/features/), both on the live server and in
+// the static build, and everything is served under the configured base
+// path. Static sites skip the visitor-dependent behaviour of the server.
+type Site struct {
+	Static   bool
+	Dev      bool // Show development aids such as the stale translation banner
+	BasePath string
+	Locales  []Locale
+	Catalogs Catalogs
+	Releases ReleaseManifest
+
+	// Time the site is built at and where it comes from, see buildTime
+	clock       time.Time
+	clockSource string
+
+	// Identifiers that could not be linked to their documentation
+	SymbolReport *SymbolReport
+
+	// Translations per language whose English text changed after they were made
+	stale map[string][]string
+
+	// Pages of the page table followed by the documentation guides, the
+	// redirects to the newest versions of module pages and the API reference
+	Pages  []Page
+	byPath map[string]Page // The same by route, see findPage
+
+	// Markdown pages, their rendered HTML and table of contents per page name
+	// and language
+	markdown map[string]map[string]MarkdownPage
+	content  map[string]map[string]template.HTML
+	toc      map[string]map[string][]TOCEntry
+
+	// Documentation tree the sidebar is built from
+	docs *DocNode
+
+	// Versioned module pages of the page table, see versions.go
+	versioned []*DocNode
+
+	// API reference of the modules and its symbols per page name
+	api        []*APIModule
+	apiSymbols map[string]*APISymbol
+
+	// C++ names that code in pages is linked to
+	symbols *SymbolIndex
+
+	// Checkouts of the modules that snippets are included from
+	sources *SourceTrees
+
+	// Stylesheet of highlighted code
+	highlightCSS string
+
+	// Files other than templates each Markdown page was rendered from, per
+	// page name and language
+	inputs map[string]map[string][]string
+
+	// Parsed templates per page name and language, and the unexecuted
+	// template of each file that copies are made from
+	templates map[string]map[string]*template.Template
+	bases     map[string]*template.Template
+
+	// Every template file, including those that failed to parse
+	templateFiles []string
+
+	// Errors of pages that cannot be rendered, such as a broken template or
+	// a missing snippet, per page name and language. The rest of the site
+	// still works, so a build can list every broken page at once.
+	pageErrors map[string]map[string]error
+}
+
+// NewSite creates a site and loads all templates at startup instead of on
+// each request. Errors of single pages do not fail it, they are served as
+// errors of those pages.
+func NewSite(config Config, static bool) (*Site, error) {
+	// The pseudo-locale has no catalog of its own
+	var codes []string
+	pseudo := false
+	for _, locale := range config.Locales {
+		if locale.Code == pseudoLanguage {
+			pseudo = true
+			continue
+		}
+		codes = append(codes, locale.Code)
+	}
+	catalogs, err := LoadCatalogs("locales", codes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translations: %v", err)
+	}
+	if pseudo {
+		catalogs.AddPseudo()
+	}
+
+	hashes, err := LoadSourceHashes("locales", codes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translation sources: %v", err)
+	}
+
+	s := &Site{Static: static, BasePath: config.BasePath, Locales: config.Locales, Catalogs: catalogs}
+	s.clock, s.clockSource, err = buildTime()
+	if err != nil {
+		return nil, err
+	}
+	s.stale = make(map[string][]string)
+	for _, lang := range codes {
+		if lang != sourceLanguage {
+			s.stale[lang] = catalogs.StaleKeys(lang, hashes[lang])
+		}
+	}
+	s.Releases, err = LoadReleases(releasesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load releases: %v", err)
+	}
+
+	docPages, docs, err := loadDocs(docsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load documentation: %v", err)
+	}
+	s.Pages = append(append([]Page{}, pages...), docPages...)
+	s.docs = docs
+
+	versioned, aliases, err := versionedPages(pages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module versions: %v", err)
+	}
+	s.Pages = append(s.Pages, aliases...)
+	s.versioned = versioned
+
+	s.api, err = LoadAPI(config.API)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API reference: %v", err)
+	}
+	s.apiSymbols = make(map[string]*APISymbol)
+	for _, m := range s.api {
+		for _, symbol := range append([]*APISymbol{m.Root}, m.Symbols...) {
+			s.apiSymbols[strings.TrimPrefix(symbol.Path, "/")] = symbol
+		}
+	}
+	s.Pages = append(s.Pages, apiPages(s.api)...)
+	s.indexPages()
+
+	for _, module := range s.Releases.ByModule() {
+		if _, ok := s.findPage(modulePath(module.Module)); !ok {
+			log.Printf("%s: module %s has no page at %s", releasesFile, module.Module, modulePath(module.Module))
+		}
+	}
+
+	manual, err := LoadSymbolMap(symbolsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load symbols: %v", err)
+	}
+	s.symbols = NewSymbolIndex(s.api, manual)
+	s.SymbolReport = NewSymbolReport()
+	s.sources = NewSourceTrees(config.Sources)
+	s.highlightCSS, err = highlightCSS()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate code styles: %v", err)
+	}
+
+	s.pageErrors = make(map[string]map[string]error)
+	if err := s.loadMarkdown(); err != nil {
+		return nil, err
+	}
+	s.loadTemplates()
+	return s, nil
+}
+
+// pageFailed records why a page cannot be rendered in a language
+func (s *Site) pageFailed(name, lang string, err error) {
+	if s.pageErrors[name] == nil {
+		s.pageErrors[name] = make(map[string]error)
+	}
+	s.pageErrors[name][lang] = err
+}
+
+// loadMarkdown reads and renders the Markdown pages. Languages without their
+// own version of a page get the source language one. Files that cannot be
+// read fail the site, errors in their content only the page.
+func (s *Site) loadMarkdown() error {
+	s.markdown = make(map[string]map[string]MarkdownPage)
+	s.content = make(map[string]map[string]template.HTML)
+	s.toc = make(map[string]map[string][]TOCEntry)
+	s.inputs = make(map[string]map[string][]string)
+
+	for _, p := range s.Pages {
+		if p.Content == "" {
+			continue
+		}
+		versions, err := LoadMarkdownPages(p.Content)
+		if err != nil {
+			return fmt.Errorf("failed to load page %s: %v", p.Name, err)
+		}
+
+		s.markdown[p.Name] = make(map[string]MarkdownPage)
+		s.content[p.Name] = make(map[string]template.HTML)
+		s.toc[p.Name] = make(map[string][]TOCEntry)
+		s.inputs[p.Name] = make(map[string][]string)
+		for _, locale := range s.Locales {
+			page, ok := versions[locale.Code]
+			if !ok {
+				page = versions[sourceLanguage]
+			}
+			s.markdown[p.Name][locale.Code] = page
+			linkSymbol := s.symbolResolver(p.Path, locale.Code)
+			body, files, err := s.sources.expandSnippets(page, linkSymbol)
+			s.inputs[p.Name][locale.Code] = append([]string{page.Path}, files...)
+			if err != nil {
+				s.pageFailed(p.Name, locale.Code, err)
+				continue
+			}
+			html, toc, err := renderMarkdown(body, s.linker(p.Path, locale.Code), linkSymbol)
+			if err != nil {
+				s.pageFailed(p.Name, locale.Code, fmt.Errorf("%s: %v", page.Path, err))
+				continue
+			}
+			s.content[p.Name][locale.Code] = html
+			s.toc[p.Name][locale.Code] = toc
+		}
+	}
+	return nil
+}
+
+// linker returns a function that points site-relative links in Markdown,
+// such as /subprojects/mr-math, to the page in the given language. Links to
+// a heading of the page itself (#usage) get the page URL, since the <base>
+// element would otherwise resolve them against the site root.
+func (s *Site) linker(page, lang string) func(string) string {
+	return func(dest string) string {
+		if strings.HasPrefix(dest, "#") {
+			return s.URL(page, lang) + dest
+		}
+		if !strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "//") {
+			return dest
+		}
+		path, fragment, found := strings.Cut(dest, "#")
+		if found {
+			fragment = "#" + fragment
+		}
+		return s.URL(path, lang) + fragment
+	}
+}
+
+// templateFile returns the template a page is rendered with in a language,
+// or "" for pages without one such as redirects. Markdown pages choose it in
+// the front matter, which may differ between languages.
+func (s *Site) templateFile(p Page, lang string) string {
+	switch {
+	case p.Template != "":
+		return p.Template
+	case p.Content != "":
+		name := s.markdown[p.Name][lang].Template
+		switch {
+		case name != "":
+		case s.isDoc(p.Name):
+			name = docsTemplate
+		default:
+			name = defaultMarkdownTemplate
+		}
+		return filepath.Join("templates", name)
+	}
+	return ""
+}
+
+// loadTemplates parses the templates of all pages. A template that does not
+// parse fails the pages using it.
+func (s *Site) loadTemplates() {
+	s.templates = make(map[string]map[string]*template.Template)
+	s.bases = make(map[string]*template.Template)
+
+	// Define base templates that should be included in every page
+	baseTemplates := []string{"templates/layout.html"}
+	s.templateFiles = append([]string{}, baseTemplates...)
+
+	// Load page templates, then give every language its own copy with the
+	// translation and URL helpers bound to that language. Pages sharing a
+	// template, such as the guides, share the copies too.
+	parsed := make(map[string]map[string]*template.Template)
+	broken := make(map[string]error)
+	for _, p := range s.Pages {
+		for _, locale := range s.Locales {
+			file := s.templateFile(p, locale.Code)
+			if file == "" {
+				continue
+			}
+			if _, ok := parsed[file]; !ok && broken[file] == nil {
+				s.templateFiles = append(s.templateFiles, file)
+				base, err := template.New(file).Funcs(s.funcs(s.DefaultLang(), nil)).ParseFiles(append(baseTemplates, file)...)
+				if err != nil {
+					broken[file] = err
+				} else {
+					s.bases[file] = base
+					parsed[file] = make(map[string]*template.Template)
+					for _, other := range s.Locales {
+						parsed[file][other.Code] = template.Must(base.Clone()).Funcs(s.funcs(other.Code, nil))
+					}
+				}
+			}
+			if err := broken[file]; err != nil {
+				s.pageFailed(p.Name, locale.Code, err)
+				continue
+			}
+
+			if s.templates[p.Name] == nil {
+				s.templates[p.Name] = make(map[string]*template.Template)
+			}
+			s.templates[p.Name][locale.Code] = parsed[file][locale.Code]
+		}
+	}
+}
+
+// funcs returns the template helpers for the given language. The inputs
+// they read are recorded with rec unless it is nil.
+func (s *Site) funcs(lang string, rec *Recorder) template.FuncMap {
+	return template.FuncMap{
+		// t translates a message key, e.g. {{t "home.subtitle"}}
+		"t": func(key string, args ...any) template.HTML {
+			rec.current().message(key)
+			return s.Catalogs.Translate(lang, key, args...)
+		},
+		// url links to another page in the current language
+		"url": func(path string) string {
+			return s.URL(path, lang)
+		},
+		// moduleURL links to the page of a module in the current language,
+		// or returns "" if the module has none
+		"moduleURL": func(module string) string {
+			if _, ok := s.findPage(modulePath(module)); !ok {
+				return ""
+			}
+			return s.URL(modulePath(module), lang)
+		},
+		// langURL links to a page in another language, used by the language
+		// picker. On the live server the choice is passed as ?lang= so that
+		// it is remembered for later visits.
+		"langURL": func(path, otherLang string) string {
+			if !s.Static {
+				return s.URL(path, otherLang) + "?lang=" + otherLang
+			}
+			return s.URL(path, otherLang)
+		},
+		// releases lists the releases of every module for the download page
+		"releases": func() []ModuleReleases {
+			rec.current().file(releasesFile)
+			return s.Releases.ByModule()
+		},
+		"fileSize": formatSize,
+	}
+}
+
+// findPage looks up a page of the page table or a guide by its route
+func (s *Site) findPage(path string) (Page, bool) {
+	p, ok := s.byPath["/"+strings.Trim(path, "/")]
+	return p, ok
+}
+
+// indexPages indexes the pages by route for findPage. The first page of a
+// route wins.
+func (s *Site) indexPages() {
+	s.byPath = make(map[string]Page, len(s.Pages))
+	for _, p := range s.Pages {
+		if _, ok := s.byPath[p.Path]; !ok {
+			s.byPath[p.Path] = p
+		}
+	}
+}
+
+// isDoc reports whether a page is part of the documentation
+func (s *Site) isDoc(name string) bool {
+	for _, node := range s.docs.all() {
+		if node.Page == name {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultLang returns the language served when none is requested
+func (s *Site) DefaultLang() string {
+	return s.Locales[0].Code
+}
+
+// Locale returns the configured locale for a language code
+func (s *Site) Locale(lang string) (Locale, bool) {
+	for _, locale := range s.Locales {
+		if locale.Code == lang {
+			return locale, true
+		}
+	}
+	return Locale{}, false
+}
+
+// URL returns the link to a route in the given language, including the
+// base path. Routes that are not pages, such as assets, only get the base
+// path prepended.
+func (s *Site) URL(path, lang string) string {
+	return strings.TrimSuffix(s.BasePath, "/") + s.route(path, lang)
+}
+
+// route returns the router path serving a route in the given language
+func (s *Site) route(path, lang string) string {
+	p, ok := s.findPage(path)
+	if !ok {
+		return path
+	}
+
+	route := "/"
+	if lang != s.DefaultLang() {
+		route += lang + "/"
+	}
+	if p.Output != "" {
+		route += p.Output + "/"
+	}
+	return route
+}
+
+// legacyLanguages are the languages the site was generated in besides
+// English before languages moved into path prefixes. Languages added since
+// never had legacy files.
+var legacyLanguages = []string{"ru"}
+
+// legacyFile returns the route of the file a page was generated to before
+// languages moved into path prefixes, e.g. /features/index_ru.html
+func (s *Site) legacyFile(p Page, lang string) string {
+	if p.Output == "" {
+		return "/index_" + lang + ".html"
+	}
+	return "/" + p.Output + "/index_" + lang + ".html"
+}
+
+// renderTemplate renders a page. When the inputs of the page are recorded,
+// it renders the recorder's copy of the template, whose helpers record what
+// they read.
+func (s *Site) renderTemplate(w http.ResponseWriter, p Page, data PageData, rec *Recorder) {
+	if err := s.pageErrors[p.Name][data.Lang]; err != nil {
+		s.renderError(w, err)
+		return
+	}
+	t, ok := s.templates[p.Name][data.Lang]
+	if file := s.templateFile(p, data.Lang); ok && rec != nil {
+		rec.current().file(file, "templates/layout.html")
+		t = rec.template(s, file, data.Lang)
+	}
+	if ok {
+		var buf strings.Builder
+		err := t.ExecuteTemplate(&buf, "layout", data)
+		if err != nil {
+			s.renderError(w, err)
+			return
+		}
+		io.WriteString(w, buf.String())
+	} else {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+	}
+}
+
+// renderError answers with the error of a page that failed to render. The
+// generator collects these in its report, the server logs them.
+func (s *Site) renderError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !s.Static {
+		log.Printf("Error rendering template: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Snippets include code from local checkouts of the modules, configured in
+// config.json as "sources": {"mr-math": "../mr-math"}. Templates call
+//
+//	{{.Snippet "mr-math" "examples/vectors.cpp" "dot"}}
+//	{{.Snippet "mr-math" "include/mr/vec.hpp" "12-30"}}
+//
+// and Markdown pages use the same arguments in a line of their own:
+//
+//	{{< snippet mr-math examples/vectors.cpp dot >}}
+//
+// A region is the code between two identical marker lines, as for Doxygen's
+// \snippet command:
+//
+//	// [dot]
+//	float d = mr::dot(a, b);
+//	// [dot]
+//
+// A snippet whose file or region is gone fails the page, and so the build.
+
+// snippetShortcode matches the snippet shortcode of Markdown pages
+var snippetShortcode = regexp.MustCompile(`(?m)^\{\{<\s*snippet\s+(\S+)\s+(\S+)\s+(\S+)\s*>\}\}[ \t]*$`)
+
+// snippetMarker matches region marker lines such as // [dot] or //! [dot]
+var snippetMarker = regexp.MustCompile(`^\s*//!?\s*\[([^\]]+)\]\s*$`)
+
+// snippetLines matches line ranges such as 12-30, or a single line
+var snippetLines = regexp.MustCompile(`^([0-9]+)(?:-([0-9]+))?$`)
+
+// snippetLanguages maps file extensions to highlighting languages
+var snippetLanguages = map[string]string{
+	".cpp": "cpp", ".cc": "cpp", ".cxx": "cpp", ".hpp": "cpp", ".h": "cpp", ".inl": "cpp",
+	".glsl": "glsl", ".vert": "glsl", ".frag": "glsl", ".comp": "glsl",
+	".cmake": "cmake", ".json": "json", ".py": "python", ".sh": "bash",
+}
+
+// SourceTrees reads snippets from the checkouts of the modules
+type SourceTrees struct {
+	dirs map[string]string
+
+	mu      sync.Mutex
+	commits map[string]string // HEAD of each checkout, looked up once
+}
+
+// NewSourceTrees creates a reader for the configured checkouts
+func NewSourceTrees(dirs map[string]string) *SourceTrees {
+	return &SourceTrees{dirs: dirs, commits: make(map[string]string)}
+}
+
+// Snippet is a piece of code taken from a checkout
+type Snippet struct {
+	Module   string
+	File     string // Relative to the checkout
+	Selector string // Region name or line range
+	Path     string // File read, empty if the module has no checkout
+	Commit   string // Commit of the checkout, empty outside of git
+	Language string
+	Code     string
+}
+
+// Snippet reads a region or line range of a file in a module's checkout
+func (t *SourceTrees) Snippet(module, file, selector string) (Snippet, error) {
+	snippet := Snippet{Module: module, File: file, Selector: selector}
+	root, ok := t.dirs[module]
+	if !ok {
+		return snippet, fmt.Errorf("snippet %s: no source tree configured for %s", snippet, module)
+	}
+	if !filepath.IsLocal(file) {
+		return snippet, fmt.Errorf("snippet %s: path leaves the source tree", snippet)
+	}
+	snippet.Path = filepath.Join(root, file)
+	data, err := os.ReadFile(snippet.Path)
+	if err != nil {
+		return snippet, fmt.Errorf("snippet %s: %v", snippet, err)
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	var code []string
+	if m := snippetLines.FindStringSubmatch(selector); m != nil {
+		first, _ := strconv.Atoi(m[1])
+		last := first
+		if m[2] != "" {
+			last, _ = strconv.Atoi(m[2])
+		}
+		if first < 1 || last < first || last > len(lines) {
+			return snippet, fmt.Errorf("snippet %s: lines out of range, the file has %d", snippet, len(lines))
+		}
+		code = lines[first-1 : last]
+	} else {
+		code, err = snippetRegion(lines, selector)
+		if err != nil {
+			return snippet, fmt.Errorf("snippet %s: %v", snippet, err)
+		}
+	}
+
+	snippet.Code = dedent(code)
+	snippet.Language = snippetLanguages[strings.ToLower(filepath.Ext(file))]
+	snippet.Commit = t.commit(module)
+	return snippet, nil
+}
+
+// String identifies the snippet in error messages, e.g. mr-math/vec.hpp#dot
+func (s Snippet) String() string {
+	return s.Module + "/" + s.File + "#" + s.Selector
+}
+
+// snippetRegion returns the lines between the two markers of a region,
+// leaving out the markers of other regions nested in it
+func snippetRegion(lines []string, name string) ([]string, error) {
+	var code []string
+	open, closed := false, false
+	for _, line := range lines {
+		m := snippetMarker.FindStringSubmatch(line)
+		switch {
+		case m != nil && strings.TrimSpace(m[1]) == name:
+			if open {
+				closed = true
+			}
+			open = !open
+		case m != nil:
+		case open:
+			code = append(code, line)
+		}
+		if closed {
+			return code, nil
+		}
+	}
+	if open {
+		return nil, fmt.Errorf("region %q is not closed", name)
+	}
+	return nil, fmt.Errorf("region %q not found", name)
+}
+
+// dedent removes the indentation shared by all non-blank lines
+func dedent(lines []string) string {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			lines[i] = line[indent:]
+		} else if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+		}
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// commit returns the commit checked out in a module's source tree
+func (t *SourceTrees) commit(module string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if commit, ok := t.commits[module]; ok {
+		return commit
+	}
+	out, err := exec.Command("git", "-C", t.dirs[module], "rev-parse", "HEAD").Output()
+	commit := ""
+	if err == nil {
+		commit = strings.TrimSpace(string(out))
+	}
+	t.commits[module] = commit
+	return commit
+}
+
+// Snippet includes code from a module's checkout in a template, e.g.
+// {{.Snippet "mr-math" "examples/vectors.cpp" "dot"}}
+func (d PageData) Snippet(module, file, selector string) (template.HTML, error) {
+	snippet, err := d.site.sources.Snippet(module, file, selector)
+	d.deps.file(snippet.Path)
+	if err != nil {
+		return "", err
+	}
+	return snippet.HTML(d.site.symbolResolver(d.Path, d.Lang)), nil
+}
+
+// HTML renders the snippet as a highlighted code block followed by its
+// source, linking C++ names with link. Both are on one line with the block
+// so that Markdown keeps them as raw HTML.
+func (s Snippet) HTML(link func(string) string) template.HTML {
+	source := s.Module + " " + s.File
+	if s.Commit != "" {
+		source += " @ " + s.Commit[:min(len(s.Commit), 12)]
+	}
+	attrs := fmt.Sprintf(` data-source="%s" data-commit="%s"`, template.HTMLEscapeString(s.String()), s.Commit)
+	return template.HTML(codeBlock(s.Code, s.Language, attrs, link) + `<p class="snippet-source">` + template.HTMLEscapeString(source) + "</p>")
+}
+
+// expandSnippets replaces the snippet shortcodes of a Markdown page, linking
+// C++ names with link, and returns the files it read. Shortcodes in fenced
+// code blocks are left as they are, so guides can show the syntax. Errors
+// name the file and line of the first shortcode that failed.
+func (t *SourceTrees) expandSnippets(page MarkdownPage, link func(string) string) ([]byte, []string, error) {
+	var b bytes.Buffer
+	var files []string
+	last := 0
+	fenced := fencedBlocks(page.Body)
+	for _, m := range snippetShortcode.FindAllSubmatchIndex(page.Body, -1) {
+		if inBlock(fenced, m[0]) {
+			continue
+		}
+		b.Write(page.Body[last:m[0]])
+		last = m[1]
+		snippet, err := t.Snippet(string(page.Body[m[2]:m[3]]), string(page.Body[m[4]:m[5]]), string(page.Body[m[6]:m[7]]))
+		if snippet.Path != "" {
+			files = append(files, snippet.Path)
+		}
+		if err != nil {
+			line := page.Line + bytes.Count(page.Body[:m[0]], []byte("\n"))
+			return nil, files, fmt.Errorf("%s:%d: %v", page.Path, line, err)
+		}
+		b.WriteString(string(snippet.HTML(link)))
+	}
+	b.Write(page.Body[last:])
+	return b.Bytes(), files, nil
+}
+
+// codeFence matches the lines opening and closing fenced code blocks
+var codeFence = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+
+// fencedBlocks returns the byte ranges of the fenced code blocks of a
+// Markdown body. A block runs to the fence of the same character at least
+// as long as its opening one, or to the end of the body.
+func fencedBlocks(body []byte) [][2]int {
+	var blocks [][2]int
+	var open string
+	start := 0
+	for offset := 0; offset < len(body); {
+		end := bytes.IndexByte(body[offset:], '\n') + 1
+		if end == 0 {
+			end = len(body) - offset
+		}
+		line := body[offset : offset+end]
+		if m := codeFence.FindSubmatch(line); m != nil {
+			fence := string(m[1])
+			switch {
+			case open == "":
+				open, start = fence, offset
+			case fence[0] == open[0] && len(fence) >= len(open) && len(bytes.TrimSpace(line)) == len(fence):
+				blocks = append(blocks, [2]int{start, offset + end})
+				open = ""
+			}
+		}
+		offset += end
+	}
+	if open != "" {
+		blocks = append(blocks, [2]int{start, len(body)})
+	}
+	return blocks
+}
+
+// inBlock reports whether a byte offset lies in one of the blocks
+func inBlock(blocks [][2]int, offset int) bool {
+	for _, block := range blocks {
+		if offset >= block[0] && offset < block[1] {
+			return true
+		}
+	}
+	return false
+}
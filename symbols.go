@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// symbolsFile maps C++ names to pages for symbols the API reference does not
+// cover, e.g. {"mr::contractor::Pipeline": "/docs/mr-contractor#pipelines"}.
+// Entries override the API reference.
+const symbolsFile = "symbols.json"
+
+// SymbolIndex resolves C++ identifiers in rendered pages to the page
+// documenting them. Qualified names match any symbol they are a suffix of,
+// so graphics::Context finds mr::graphics::Context; unqualified names only
+// match types, since words such as "length" are too common in code.
+type SymbolIndex struct {
+	targets  map[string]string   // Route or URL per qualified name
+	types    map[string]bool     // Qualified names of classes, enums and manual entries
+	suffixes map[string][]string // Qualified names per name suffix
+	roots    map[string]bool     // Outermost namespaces, whose unknown names are reported
+}
+
+// LoadSymbolMap reads the manual symbol mapping. A missing file means there
+// are no manual entries.
+func LoadSymbolMap(path string) (map[string]string, error) {
+	symbols := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return symbols, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &symbols); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return symbols, nil
+}
+
+// NewSymbolIndex indexes the symbols of the API reference and the manual
+// mapping
+func NewSymbolIndex(modules []*APIModule, manual map[string]string) *SymbolIndex {
+	x := &SymbolIndex{
+		targets:  make(map[string]string),
+		types:    make(map[string]bool),
+		suffixes: make(map[string][]string),
+		roots:    make(map[string]bool),
+	}
+	add := func(name, target string, isType bool) {
+		name = strings.TrimPrefix(name, "::")
+		if _, ok := x.targets[name]; !ok {
+			for suffix := name; ; {
+				x.suffixes[suffix] = append(x.suffixes[suffix], name)
+				_, rest, found := strings.Cut(suffix, "::")
+				if !found {
+					break
+				}
+				suffix = rest
+			}
+		}
+		x.targets[name] = target
+		x.types[name] = x.types[name] || isType
+		if root, _, found := strings.Cut(name, "::"); found {
+			x.roots[root] = true
+		}
+	}
+
+	for _, m := range modules {
+		for _, symbol := range m.Symbols {
+			add(symbol.Qualified, symbol.Path, apiGroupKinds[symbol.Kind] == "class" || symbol.Kind == "enum")
+		}
+	}
+	for name, target := range manual {
+		add(name, target, true)
+	}
+	return x
+}
+
+// Resolve looks up an identifier. It returns the target of a unique match,
+// the candidates of an ambiguous one, and whether an unmatched identifier is
+// worth reporting because it names something in one of our namespaces.
+func (x *SymbolIndex) Resolve(name string) (target string, candidates []string, unresolved bool) {
+	name = strings.TrimPrefix(name, "::")
+	qualified := strings.Contains(name, "::")
+	if target, ok := x.targets[name]; ok && (qualified || x.types[name]) {
+		return target, nil, false
+	}
+
+	for _, candidate := range x.suffixes[name] {
+		if qualified || x.types[candidate] {
+			candidates = append(candidates, candidate)
+		}
+	}
+	switch {
+	case len(candidates) == 1:
+		return x.targets[candidates[0]], nil, false
+	case len(candidates) > 1:
+		sort.Strings(candidates)
+		return "", candidates, false
+	}
+	root, _, _ := strings.Cut(name, "::")
+	return "", nil, qualified && x.roots[root]
+}
+
+// SymbolReport collects the identifiers that could not be linked while
+// pages were rendered
+type SymbolReport struct {
+	mu         sync.Mutex
+	Ambiguous  map[string][]string        // Candidates per identifier
+	Unresolved map[string]map[string]bool // Routes per identifier
+	Pages      map[string]map[string]bool // Routes per ambiguous identifier
+}
+
+// NewSymbolReport creates an empty report
+func NewSymbolReport() *SymbolReport {
+	return &SymbolReport{
+		Ambiguous:  make(map[string][]string),
+		Unresolved: make(map[string]map[string]bool),
+		Pages:      make(map[string]map[string]bool),
+	}
+}
+
+func (r *SymbolReport) ambiguous(name string, candidates []string, route string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Ambiguous[name] = candidates
+	if r.Pages[name] == nil {
+		r.Pages[name] = make(map[string]bool)
+	}
+	r.Pages[name][route] = true
+}
+
+func (r *SymbolReport) unresolved(name, route string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Unresolved[name] == nil {
+		r.Unresolved[name] = make(map[string]bool)
+	}
+	r.Unresolved[name][route] = true
+}
+
+// OK reports whether every identifier could be linked or left alone
+func (r *SymbolReport) OK() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Ambiguous) == 0 && len(r.Unresolved) == 0
+}
+
+// Print writes the report in a human readable form
+func (r *SymbolReport) Print() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.Ambiguous) > 0 {
+		fmt.Println("Ambiguous symbols (not linked, qualify them further):")
+		for _, name := range sortedKeys(r.Ambiguous) {
+			fmt.Printf("  %s could be %s (%s)\n", name, strings.Join(r.Ambiguous[name], ", "), strings.Join(sortedKeys(r.Pages[name]), ", "))
+		}
+	}
+	if len(r.Unresolved) > 0 {
+		fmt.Printf("Unresolved symbols (not in the API reference or %s):\n", symbolsFile)
+		for _, name := range sortedKeys(r.Unresolved) {
+			fmt.Printf("  %s (%s)\n", name, strings.Join(sortedKeys(r.Unresolved[name]), ", "))
+		}
+	}
+}
+
+// SymbolIssues are the identifiers of one route that could not be linked.
+// The build cache keeps them so that pages it reuses are still reported.
+type SymbolIssues struct {
+	Ambiguous  map[string][]string `json:"ambiguous,omitempty"`
+	Unresolved []string            `json:"unresolved,omitempty"`
+}
+
+// route returns the issues found on a route
+func (r *SymbolReport) route(route string) SymbolIssues {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var issues SymbolIssues
+	for _, name := range sortedKeys(r.Pages) {
+		if r.Pages[name][route] {
+			if issues.Ambiguous == nil {
+				issues.Ambiguous = make(map[string][]string)
+			}
+			issues.Ambiguous[name] = r.Ambiguous[name]
+		}
+	}
+	for _, name := range sortedKeys(r.Unresolved) {
+		if r.Unresolved[name][route] {
+			issues.Unresolved = append(issues.Unresolved, name)
+		}
+	}
+	return issues
+}
+
+// add records the issues of a route found by an earlier build
+func (r *SymbolReport) add(route string, issues SymbolIssues) {
+	for name, candidates := range issues.Ambiguous {
+		r.ambiguous(name, candidates, route)
+	}
+	for _, name := range issues.Unresolved {
+		r.unresolved(name, route)
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// identifierPattern matches C++ identifiers, possibly qualified
+var identifierPattern = regexp.MustCompile(`^(?:::)?[A-Za-z_]\w*(?:::[A-Za-z_]\w*)*$`)
+
+// symbolResolver returns a function that links C++ identifiers on a page to
+// their documentation, recording those it cannot link in the report. Links
+// from a symbol's page to itself are left out.
+func (s *Site) symbolResolver(route, lang string) func(string) string {
+	self := s.URL(route, lang)
+	link := s.linker(route, lang)
+	return func(name string) string {
+		target, candidates, unresolved := s.symbols.Resolve(name)
+		switch {
+		case len(candidates) > 0:
+			s.SymbolReport.ambiguous(name, candidates, route)
+		case unresolved:
+			s.SymbolReport.unresolved(name, route)
+		}
+		if target == "" {
+			return ""
+		}
+		url := link(target)
+		if base, _, _ := strings.Cut(url, "#"); base == self {
+			return ""
+		}
+		return url
+	}
+}
+
+// isIdentifier reports whether inline code is a single identifier such as
+// mr::Vec3f or mr::dot()
+func isIdentifier(code string) bool {
+	code = strings.TrimSuffix(code, "()")
+	return identifierPattern.MatchString(code)
+}
+
+// checkSymbolsCommand implements `go run . check-symbols`. It renders every
+// page and lists the C++ identifiers that are ambiguous or point into our
+// namespaces without documentation.
+func checkSymbolsCommand(config Config, args []string) int {
+	s, err := NewSite(config, true)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	router := newRouter(s)
+	for _, p := range s.Pages {
+		for _, locale := range s.Locales {
+			req := httptest.NewRequest("GET", s.URL(p.Path, locale.Code), nil)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}
+
+	s.SymbolReport.Print()
+	if !s.SymbolReport.OK() {
+		return 1
+	}
+	fmt.Println("All symbols resolved.")
+	return 0
+}
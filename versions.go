@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Module pages of the page table can be kept per release of the module, like
+// versioned documentation sections (see docs.go). The entry of the newest
+// release keeps the route of the page, older releases move below it:
+//
+//	{Name: "mr-graphics", Path: "/subprojects/mr-graphics", Version: "v0.4", ...}
+//	{Name: "mr-graphics/v0.3", Path: "/subprojects/mr-graphics/v0.3", Version: "v0.3", ...}
+//
+// As for documentation, the newest release is also reachable under
+// /subprojects/mr-graphics/latest/ and /subprojects/mr-graphics/v0.4/, which
+// redirect to it, so links to a release keep working once it is superseded.
+
+// versionedPages groups the versioned pages of the page table into sections
+// like those of the documentation tree, and returns them with the redirects
+// to their newest version
+func versionedPages(table []Page) ([]*DocNode, []Page, error) {
+	sections := make(map[string]*DocNode)
+	for _, p := range table {
+		if p.Version == "" {
+			continue
+		}
+		route := p.Path
+		if versionPattern.MatchString(path.Base(route)) {
+			route = path.Dir(route)
+		}
+		section, ok := sections[route]
+		if !ok {
+			section = &DocNode{Path: route, Name: path.Base(route)}
+			sections[route] = section
+		}
+		section.Versions = append(section.Versions, &DocNode{Page: p.Name, Path: p.Path, Name: section.Name, Version: p.Version})
+	}
+
+	var result []*DocNode
+	var aliases []Page
+	for _, route := range sortedKeys(sections) {
+		section := sections[route]
+		sort.Slice(section.Versions, func(i, j int) bool {
+			return compareVersions(section.Versions[i].Version, section.Versions[j].Version) > 0
+		})
+		latest := section.Versions[0]
+		if latest.Path != route {
+			return nil, nil, fmt.Errorf("%s: the newest version %s must keep the route of the page", route, latest.Version)
+		}
+		for _, version := range section.Versions[1:] {
+			if version.Path != route+"/"+version.Version {
+				return nil, nil, fmt.Errorf("%s: older versions move below the route of the page, %s to %s/%s", route, version.Version, route, version.Version)
+			}
+		}
+		aliases = append(aliases, latestAliases(section)...)
+		result = append(result, section)
+	}
+	return result, aliases, nil
+}
+
+// DocVersion links to a page in one version of a versioned section
+type DocVersion struct {
+	Version string
+	URL     string
+	Current bool // Version being shown
+	Latest  bool
+}
+
+// VersionNav is the version selector of a page kept per release
+type VersionNav struct {
+	Section  string       // Title of the section, e.g. mr-graphics
+	Versions []DocVersion // Every version, newest first
+	Outdated *DocVersion  // Newest version, when an older one is shown
+}
+
+// pageVersions returns the version selector of a page of a versioned
+// documentation section or module page, or nil for other pages. Each
+// version links to the same guide in that version if it has one, and to
+// the version's overview otherwise.
+func (s *Site) pageVersions(p Page, lang string) *VersionNav {
+	for _, root := range append([]*DocNode{s.docs}, s.versioned...) {
+		section, current, ok := root.versionOf(p.Name)
+		if !ok {
+			continue
+		}
+
+		rel := strings.TrimPrefix(p.Path, current.Path)
+		nav := &VersionNav{Section: s.docTitle(current, lang)}
+		for i, version := range section.Versions {
+			target := version.Path + rel
+			if _, ok := s.findPage(target); !ok {
+				target = version.Path
+			}
+			nav.Versions = append(nav.Versions, DocVersion{
+				Version: version.Version,
+				URL:     s.URL(target, lang),
+				Current: version == current,
+				Latest:  i == 0,
+			})
+		}
+		if current != section.Versions[0] {
+			nav.Outdated = &nav.Versions[0]
+		}
+		return nav
+	}
+	return nil
+}
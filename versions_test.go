@@ -0,0 +1,190 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGuides creates Markdown files below dir, mapping paths to titles
+func writeGuides(t *testing.T, dir string, guides map[string]string) {
+	t.Helper()
+	for file, title := range guides {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("---\ntitle: "+title+"\n---\n\nText\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testSite returns a site serving pages in English only
+func testSite(table []Page, docs *DocNode, versioned []*DocNode) *Site {
+	s := &Site{Locales: []Locale{{Code: sourceLanguage}}, Pages: table, docs: docs, versioned: versioned}
+	s.indexPages()
+	return s
+}
+
+// redirects returns the redirects among pages by route
+func redirects(pages []Page) map[string]string {
+	result := make(map[string]string)
+	for _, p := range pages {
+		if p.Redirect != "" {
+			result[p.Path] = p.Redirect
+		}
+	}
+	return result
+}
+
+func TestVersionedDocs(t *testing.T) {
+	dir := t.TempDir()
+	writeGuides(t, dir, map[string]string{
+		"index.en.md":                     "Docs",
+		"mr-graphics/v0.2/index.en.md":    "mr-graphics",
+		"mr-graphics/v0.2/shaders.en.md":  "Shaders",
+		"mr-graphics/v0.10/index.en.md":   "mr-graphics",
+		"mr-graphics/v0.10/shaders.en.md": "Shaders",
+		"mr-graphics/v0.10/shadows.en.md": "Shadows",
+	})
+	docPages, docs, err := loadDocs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases := redirects(docPages)
+	// The newest version is served at the routes of the section
+	for alias, target := range map[string]string{
+		"/docs/mr-graphics/latest":         "/docs/mr-graphics",
+		"/docs/mr-graphics/v0.10":          "/docs/mr-graphics",
+		"/docs/mr-graphics/v0.10/shadows":  "/docs/mr-graphics/shadows",
+		"/docs/mr-graphics/latest/shaders": "/docs/mr-graphics/shaders",
+		"/docs/mr-graphics/v0.2/shaders":   "",
+		"/docs/mr-graphics/shaders":        "",
+		"/docs/mr-graphics/latest/shadows": "/docs/mr-graphics/shadows",
+	} {
+		if aliases[alias] != target {
+			t.Errorf("%s redirects to %q, want %q", alias, aliases[alias], target)
+		}
+	}
+
+	s := testSite(append([]Page{{Name: "docs", Path: "/docs", Output: "docs"}}, docPages...), docs, nil)
+	page := func(route string) Page {
+		p, ok := s.findPage(route)
+		if !ok {
+			t.Fatalf("no page %s", route)
+		}
+		return p
+	}
+
+	// An older version lists both, newest first, and links to the newest
+	nav := s.pageVersions(page("/docs/mr-graphics/v0.2/shaders"), sourceLanguage)
+	if nav == nil || len(nav.Versions) != 2 {
+		t.Fatalf("versions of an old guide: %+v", nav)
+	}
+	if nav.Versions[0].Version != "v0.10" || !nav.Versions[0].Latest || nav.Versions[1].Version != "v0.2" || !nav.Versions[1].Current {
+		t.Errorf("versions of an old guide: %+v", nav.Versions)
+	}
+	if nav.Outdated == nil || nav.Outdated.URL != "/docs/mr-graphics/shaders/" {
+		t.Errorf("old guide links to the newest as %+v", nav.Outdated)
+	}
+
+	// The newest version is not outdated, and guides missing in a version
+	// link to its overview
+	nav = s.pageVersions(page("/docs/mr-graphics/shadows"), sourceLanguage)
+	if nav == nil || nav.Outdated != nil {
+		t.Fatalf("newest guide: %+v", nav)
+	}
+	if nav.Versions[1].URL != "/docs/mr-graphics/v0.2/" {
+		t.Errorf("guide missing in v0.2 links to %s", nav.Versions[1].URL)
+	}
+
+	// The sidebar shows the version of the page
+	if got := docs.flatten("docs/mr-graphics/v0.2/shaders"); len(got) != 3 || got[1].Page != "docs/mr-graphics/v0.2" {
+		t.Errorf("pages in the order of an old guide: %d", len(got))
+	}
+
+	if nav := s.pageVersions(page("/docs"), sourceLanguage); nav != nil {
+		t.Errorf("unversioned page has versions %+v", nav)
+	}
+}
+
+func TestVersionedPages(t *testing.T) {
+	table := []Page{
+		{Name: "mr-graphics", Path: "/subprojects/mr-graphics", Output: "subprojects/mr-graphics", Version: "v0.4"},
+		{Name: "mr-graphics/v0.3", Path: "/subprojects/mr-graphics/v0.3", Output: "subprojects/mr-graphics/v0.3", Version: "v0.3"},
+		{Name: "mr-math", Path: "/subprojects/mr-math", Output: "subprojects/mr-math"},
+	}
+	versioned, aliases, err := versionedPages(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versioned) != 1 {
+		t.Fatalf("%d versioned pages, want 1", len(versioned))
+	}
+	got := redirects(aliases)
+	for _, alias := range []string{"/subprojects/mr-graphics/latest", "/subprojects/mr-graphics/v0.4"} {
+		if got[alias] != "/subprojects/mr-graphics" {
+			t.Errorf("%s redirects to %q", alias, got[alias])
+		}
+	}
+
+	s := testSite(append(table, aliases...), &DocNode{Page: "docs", Path: "/docs"}, versioned)
+	nav := s.pageVersions(table[1], sourceLanguage)
+	if nav == nil || nav.Section != "mr-graphics" || len(nav.Versions) != 2 {
+		t.Fatalf("versions of the old page: %+v", nav)
+	}
+	if nav.Outdated == nil || nav.Outdated.URL != "/subprojects/mr-graphics/" {
+		t.Errorf("old page links to the newest as %+v", nav.Outdated)
+	}
+	if nav := s.pageVersions(table[0], sourceLanguage); nav == nil || nav.Outdated != nil || !nav.Versions[0].Current {
+		t.Errorf("versions of the newest page: %+v", nav)
+	}
+	if nav := s.pageVersions(table[2], sourceLanguage); nav != nil {
+		t.Errorf("unversioned page has versions %+v", nav)
+	}
+
+	// Links to the page must keep leading to the newest release
+	table[0].Version, table[1].Version = "v0.3", "v0.4"
+	if _, _, err := versionedPages(table); err == nil {
+		t.Error("older version at the route of the page was accepted")
+	}
+}
+
+// Documentation sections and module pages put their versions at the same
+// routes, so the version selector works alike on both
+func TestVersionedRoutesAgree(t *testing.T) {
+	dir := t.TempDir()
+	writeGuides(t, dir, map[string]string{
+		"index.en.md":                  "Docs",
+		"mr-graphics/v0.2/index.en.md": "mr-graphics",
+		"mr-graphics/v0.3/index.en.md": "mr-graphics",
+	})
+	docPages, docs, err := loadDocs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versioned, modulePages, err := versionedPages([]Page{
+		{Name: "mr-graphics", Path: "/subprojects/mr-graphics", Version: "v0.3"},
+		{Name: "mr-graphics/v0.2", Path: "/subprojects/mr-graphics/v0.2", Version: "v0.2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases := redirects(append(docPages, modulePages...))
+	for _, section := range []*DocNode{docs.Children[0], versioned[0]} {
+		if got := section.Versions[0].Path; got != section.Path {
+			t.Errorf("newest version of %s is at %s", section.Path, got)
+		}
+		if got := section.Versions[1].Path; got != section.Path+"/v0.2" {
+			t.Errorf("older version of %s is at %s", section.Path, got)
+		}
+		for _, alias := range []string{section.Path + "/latest", section.Path + "/v0.3"} {
+			if aliases[alias] != section.Path {
+				t.Errorf("%s redirects to %q, want %q", alias, aliases[alias], section.Path)
+			}
+		}
+	}
+}